@@ -0,0 +1,145 @@
+package cloudfunction
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	AuditStoryCreated     = "story_created"
+	AuditCommentAdded     = "comment_added"
+	AuditStateChanged     = "state_changed"
+	AuditSkippedDuplicate = "skipped_duplicate"
+	AuditCommentFiltered  = "comment_filtered"
+	AuditOwnersChanged    = "owners_changed"
+	AuditEpicCreated      = "epic_created"
+	AuditDeadlineFlagged  = "deadline_flagged"
+	AuditStoryReopened    = "story_reopened"
+)
+
+// AuditEntry records one change the adapter made, or decided not to make, in Clubhouse
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	TicketID string    `json:"ticket_id"`
+	StoryID  int       `json:"story_id"`
+	Comment  string    `json:"comment,omitempty"`
+	Before   string    `json:"before,omitempty"`
+	After    string    `json:"after,omitempty"`
+	Actor    string    `json:"actor"`
+
+	// Redactions counts the sensitive values masked in the content sent to Clubhouse
+	Redactions RedactionCounts `json:"redactions,omitempty"`
+}
+
+type AuditSink interface {
+	Write(*AuditEntry) error
+	Query(string) ([]AuditEntry, error)
+}
+
+// FileAuditSink appends one JSON line per entry to Path
+type FileAuditSink struct {
+	Path string
+}
+
+// auditFileMu serializes appends, entries of concurrent workers must not interleave
+var auditFileMu sync.Mutex
+
+func AuditSinkBuilder(path string) AuditSink {
+	return &FileAuditSink{path}
+}
+
+var auditLogPathOnce sync.Once
+
+// AuditLog returns the sink configured by AUDIT_LOG_PATH. Without it entries
+// go to audit.jsonl in the working directory, never to a temporary directory
+// which is wiped with the instance
+func AuditLog() AuditSink {
+	path := os.Getenv("AUDIT_LOG_PATH")
+	if path == "" {
+		path = "audit.jsonl"
+		auditLogPathOnce.Do(func() {
+			slog.Warn("AUDIT_LOG_PATH is not set, the audit log is written to the working directory", "path", path)
+		})
+	}
+	return AuditSinkBuilder(path)
+}
+
+func (s *FileAuditSink) Write(entry *AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	auditFileMu.Lock()
+	defer auditFileMu.Unlock()
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// Query returns the entries of a ticket in the order they were written
+func (s *FileAuditSink) Query(ticketID string) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+
+	file, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry = AuditEntry{}
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if entry.TicketID == ticketID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+type actorKey struct{}
+
+// withActor tells the audit log who triggered the sync
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	return "unknown"
+}
+
+func audit(ctx context.Context, entry AuditEntry) {
+	entry.Time = time.Now().UTC()
+	entry.Actor = actorFrom(ctx)
+	if plan := dryRunPlanFrom(ctx); plan != nil {
+		plan.mu.Lock()
+		plan.Audit = append(plan.Audit, entry)
+		plan.mu.Unlock()
+		return
+	}
+	err := AuditLog().Write(&entry)
+	if err != nil {
+		loggerFrom(ctx).Error("Fail to write audit entry", "audit_action", entry.Action, "error", err)
+	}
+}
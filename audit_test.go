@@ -0,0 +1,96 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileAuditSink(t *testing.T) {
+	sink := AuditSinkBuilder(filepath.Join(t.TempDir(), "audit.jsonl"))
+
+	entries, err := sink.Query("7777")
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("got: %v %v, want no entries", entries, err)
+	}
+
+	for _, entry := range []AuditEntry{
+		{Action: AuditStoryCreated, TicketID: "7777", StoryID: 777},
+		{Action: AuditStoryCreated, TicketID: "8888", StoryID: 888},
+		{Action: AuditStateChanged, TicketID: "7777", StoryID: 777, Before: "Created", After: "Completed"},
+	} {
+		if err := sink.Write(&entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err = sink.Query("7777")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != AuditStoryCreated || entries[1].After != "Completed" {
+		t.Fatalf("got: %v, want the two entries of ticket 7777", entries)
+	}
+}
+
+func TestZendeskClubhouseAdapter_Audit(t *testing.T) {
+	tests := map[string]struct {
+		method      string
+		path        string
+		payload     string
+		ticketID    string
+		wantActions []string
+	}{
+		"create story":       {http.MethodPost, "/tickets", `{"title": "unit test", "id": "NON_EXIST_ID", "url": "http://unittest.io" }`, "NON_EXIST_ID", []string{AuditStoryCreated}},
+		"skip duplicate":     {http.MethodPost, "/tickets", `{"title": "unit test", "id": "7777", "url": "http://unittest.io" }`, "7777", []string{AuditSkippedDuplicate}},
+		"comment and status": {http.MethodPut, "/", `{"id": "7777", "description": "Hello world", "status": "Pending" }`, "7777", []string{AuditCommentAdded, AuditStateChanged}},
+	}
+
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	t.Setenv("AUTH_USER", "zendesk")
+	t.Setenv("AUTH_PASSWORD", "YouShallNotPass!")
+	defer SetMappingStore(NewMemoryMappingStore())
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var entries []AuditEntry
+			t.Setenv("AUDIT_LOG_PATH", filepath.Join(t.TempDir(), "audit.jsonl"))
+			SetMappingStore(NewMemoryMappingStore())
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.path, bytes.NewBuffer([]byte(tt.payload)))
+			r.SetBasicAuth("zendesk", "YouShallNotPass!")
+			ZendeskClubhouseAdapter(w, r)
+			if s := w.Result().StatusCode; s >= 300 {
+				t.Fatalf("got: %d, want success", s)
+			}
+
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/tickets/"+tt.ticketID+"/audit", nil)
+			r.SetBasicAuth("zendesk", "YouShallNotPass!")
+			ZendeskClubhouseAdapter(w, r)
+			json.NewDecoder(w.Result().Body).Decode(&entries)
+			if len(entries) != len(tt.wantActions) {
+				t.Fatalf("got: %v, want: %v", entries, tt.wantActions)
+			}
+			for i, entry := range entries {
+				if entry.Action != tt.wantActions[i] || entry.Actor != "zendesk" {
+					t.Fatalf("got: %s by %s, want: %s by zendesk", entry.Action, entry.Actor, tt.wantActions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestZendeskClubhouseAdapter_AuditWithoutCredentials(t *testing.T) {
+	os.Setenv("AUTH_USER", "")
+	os.Setenv("AUTH_PASSWORD", "")
+	w := httptest.NewRecorder()
+	ZendeskClubhouseAdapter(w, httptest.NewRequest(http.MethodGet, "/tickets/7777/audit", nil))
+	if s := w.Result().StatusCode; s != http.StatusForbidden {
+		t.Fatalf("got: %d, want: %d", s, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,186 @@
+package cloudfunction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BackfillOptions selects the tickets to import, either by search Query or by ViewID
+type BackfillOptions struct {
+	Query      string
+	ViewID     string
+	Rate       float64 // tickets per second, 0 for no limit
+	Checkpoint string  // file to resume from, none if empty
+	Limit      int     // tickets to import at most, 0 for all
+	DryRun     bool
+}
+
+// BackfillReport sums up a backfill, Failures are errors by ticket ID
+type BackfillReport struct {
+	Processed int               `json:"processed"`
+	Created   int               `json:"created"`
+	Skipped   int               `json:"skipped"`
+	Failed    int               `json:"failed"`
+	Failures  map[string]string `json:"failures,omitempty"`
+	Plans     []*DryRunPlan     `json:"plans,omitempty"`
+	Complete  bool              `json:"complete"`
+}
+
+// backfillCheckpoint is where to resume: the page being imported, by the URL
+// it was fetched from, and how many of its tickets are done
+type backfillCheckpoint struct {
+	Query  string         `json:"query"`
+	ViewID string         `json:"view_id"`
+	Page   string         `json:"page"`
+	Index  int            `json:"index"`
+	Report BackfillReport `json:"report"`
+}
+
+func loadCheckpoint(path string, checkpoint *backfillCheckpoint) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, checkpoint)
+}
+
+func saveCheckpoint(path string, checkpoint *backfillCheckpoint) error {
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path+".tmp", data, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Backfill creates the stories of existing Zendesk tickets the same way new
+// tickets are, tickets already linked to a story are skipped. It saves its
+// progress after each ticket so an interrupted backfill resumes where it
+// stopped, the checkpoint is removed once all pages are imported
+func Backfill(ctx context.Context, zendesk AbstractZendesk, options BackfillOptions) (report BackfillReport, err error) {
+	var checkpoint = backfillCheckpoint{Query: options.Query, ViewID: options.ViewID}
+	var page = ZendeskTicketPage{}
+
+	if (options.Query == "") == (options.ViewID == "") {
+		return report, os.ErrInvalid
+	}
+
+	ctx, span := tracer.Start(ctx, "backfill", trace.WithAttributes(
+		attribute.String("zendesk.query", options.Query),
+		attribute.String("zendesk.view_id", options.ViewID),
+		attribute.Bool("backfill.dry_run", options.DryRun),
+	))
+	defer func() { endSpan(span, err) }()
+	ctx = withActor(ctx, "backfill")
+
+	if options.Checkpoint != "" && !options.DryRun {
+		err = loadCheckpoint(options.Checkpoint, &checkpoint)
+		if err != nil {
+			return report, err
+		}
+		if checkpoint.Query != options.Query || checkpoint.ViewID != options.ViewID {
+			return report, fmt.Errorf("checkpoint %s belongs to another query or view", options.Checkpoint)
+		}
+	}
+	report = checkpoint.Report
+	if report.Failures == nil {
+		report.Failures = map[string]string{}
+	}
+
+	var throttle <-chan time.Time
+	if options.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / options.Rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	for {
+		if options.ViewID != "" {
+			err = zendesk.ViewTickets(options.ViewID, checkpoint.Page, &page)
+		} else {
+			err = zendesk.SearchTickets(options.Query, checkpoint.Page, &page)
+		}
+		if err != nil {
+			return report, err
+		}
+
+		for checkpoint.Index < len(page.Tickets) {
+			if options.Limit > 0 && report.Processed >= options.Limit {
+				return report, nil
+			}
+			if throttle != nil {
+				select {
+				case <-ctx.Done():
+					return report, ctx.Err()
+				case <-throttle:
+				}
+			} else if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+
+			zendeskTicket := page.Tickets[checkpoint.Index].ToZendeskTicket(zendesk, page.Organizations, page.Users)
+			backfillTicket(ctx, &zendeskTicket, options, &report)
+			checkpoint.Index++
+
+			if options.Checkpoint != "" && !options.DryRun {
+				checkpoint.Report = report
+				err = saveCheckpoint(options.Checkpoint, &checkpoint)
+				if err != nil {
+					return report, err
+				}
+			}
+		}
+
+		if page.NextPage == "" {
+			break
+		}
+		checkpoint.Page, checkpoint.Index = page.NextPage, 0
+	}
+
+	report.Complete = true
+	if options.Checkpoint != "" && !options.DryRun {
+		err = os.Remove(options.Checkpoint)
+		if err != nil && !os.IsNotExist(err) {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func backfillTicket(ctx context.Context, zendeskTicket *ZendeskTicket, options BackfillOptions, report *BackfillReport) {
+	var plan *DryRunPlan
+
+	ctx = withTicket(ctx, zendeskTicket.ID)
+	if options.DryRun {
+		plan = &DryRunPlan{Action: ActionCreate, TicketID: zendeskTicket.ID, Audit: []AuditEntry{}}
+		ctx = withDryRun(ctx, plan)
+	}
+
+	report.Processed++
+	created, err := createStory(ctx, zendeskTicket)
+	switch {
+	case err != nil:
+		loggerFrom(ctx).Error("Fail to backfill ticket", "error", err)
+		report.Failed++
+		report.Failures[zendeskTicket.ID] = err.Error()
+	case created:
+		report.Created++
+		if plan != nil {
+			report.Plans = append(report.Plans, plan)
+		}
+	default:
+		report.Skipped++
+	}
+}
@@ -0,0 +1,78 @@
+package cloudfunction
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackfill(t *testing.T) {
+	tests := map[string]struct {
+		options     BackfillOptions
+		wantReport  BackfillReport
+		wantMapping bool
+		wantErr     bool
+	}{
+		"search":                {BackfillOptions{Query: "status<solved"}, BackfillReport{Processed: 3, Created: 1, Skipped: 2, Complete: true}, true, false},
+		"view":                  {BackfillOptions{ViewID: "360"}, BackfillReport{Processed: 3, Created: 1, Skipped: 2, Complete: true}, true, false},
+		"limit":                 {BackfillOptions{Query: "status<solved", Limit: 1}, BackfillReport{Processed: 1, Skipped: 1}, false, false},
+		"dry run":               {BackfillOptions{Query: "status<solved", DryRun: true}, BackfillReport{Processed: 3, Created: 1, Skipped: 2, Complete: true}, false, false},
+		"neither query or view": {BackfillOptions{}, BackfillReport{}, false, true},
+	}
+
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	defer SetMappingStore(NewMemoryMappingStore())
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			SetMappingStore(NewMemoryMappingStore())
+
+			report, err := Backfill(context.Background(), &MockZendesk{"unittest"}, tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Backfill() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if report.Processed != tt.wantReport.Processed || report.Created != tt.wantReport.Created ||
+				report.Skipped != tt.wantReport.Skipped || report.Complete != tt.wantReport.Complete {
+				t.Errorf("got: %+v, want: %+v", report, tt.wantReport)
+			}
+			if tt.options.DryRun && len(report.Plans) != 1 {
+				t.Errorf("got %d plans, want 1", len(report.Plans))
+			}
+			if _, err := Mappings().Get("9999"); (err == nil) != tt.wantMapping {
+				t.Errorf("mapping of 9999: %v, want stored: %v", err, tt.wantMapping)
+			}
+		})
+	}
+}
+
+func TestBackfillResume(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	SetMappingStore(NewMemoryMappingStore())
+	defer SetMappingStore(NewMemoryMappingStore())
+
+	// Stop in the middle of the first page
+	report, err := Backfill(context.Background(), &MockZendesk{"unittest"}, BackfillOptions{Query: "status<solved", Checkpoint: checkpoint, Limit: 1})
+	if err != nil || report.Processed != 1 {
+		t.Fatalf("got: %+v %v, want 1 processed ticket", report, err)
+	}
+	if _, err := os.Stat(checkpoint); err != nil {
+		t.Fatalf("checkpoint should be saved: %v", err)
+	}
+
+	if _, err := Backfill(context.Background(), &MockZendesk{"unittest"}, BackfillOptions{ViewID: "360", Checkpoint: checkpoint}); err == nil {
+		t.Fatal("checkpoint of another query should be refused")
+	}
+
+	report, err = Backfill(context.Background(), &MockZendesk{"unittest"}, BackfillOptions{Query: "status<solved", Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Processed != 3 || report.Created != 1 || report.Skipped != 2 || !report.Complete {
+		t.Errorf("got: %+v, want 3 processed tickets", report)
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("checkpoint should be removed once complete: %v", err)
+	}
+}
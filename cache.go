@@ -0,0 +1,130 @@
+package cloudfunction
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type metadataCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+var (
+	metadataCacheMu sync.Mutex
+	metadataCache   = map[string]metadataCacheEntry{}
+)
+
+func metadataCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(getEnv("METADATA_CACHE_TTL", "5m"))
+	if err != nil {
+		return 5 * time.Minute
+	}
+	return ttl
+}
+
+// cached returns the value of a previous successful lookup until it expires,
+// failed lookups are never cached
+func cached[T any](kind string, key string, lookup func() (T, error)) (T, error) {
+	ttl := metadataCacheTTL()
+	key = kind + "\x00" + key
+
+	metadataCacheMu.Lock()
+	entry, ok := metadataCache[key]
+	metadataCacheMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		metadataCacheTotal.WithLabelValues(kind, "hit").Inc()
+		return entry.value.(T), nil
+	}
+	metadataCacheTotal.WithLabelValues(kind, "miss").Inc()
+
+	value, err := lookup()
+	if err != nil || ttl <= 0 {
+		return value, err
+	}
+
+	metadataCacheMu.Lock()
+	metadataCache[key] = metadataCacheEntry{value, time.Now().Add(ttl)}
+	metadataCacheMu.Unlock()
+	return value, nil
+}
+
+// cachedClubHouse serves project, team, workflow, member, epic, milestone and custom field
+// lookups from memory, they rarely change but are needed for almost every ticket
+type cachedClubHouse struct {
+	AbstractClubHouse
+	token string
+}
+
+func (c *cachedClubHouse) GetProjectByName(name string) (int, error) {
+	return cached("project", c.token+"\x00"+name, func() (int, error) {
+		return c.AbstractClubHouse.GetProjectByName(name)
+	})
+}
+
+func (c *cachedClubHouse) GetTeamByName(name string) (string, error) {
+	return cached("team", c.token+"\x00"+name, func() (string, error) {
+		return c.AbstractClubHouse.GetTeamByName(name)
+	})
+}
+
+func (c *cachedClubHouse) GetWorkflowStateByName(workflowName string, stateName string) (int, error) {
+	return cached("workflow_state", c.token+"\x00"+workflowName+"\x00"+stateName, func() (int, error) {
+		return c.AbstractClubHouse.GetWorkflowStateByName(workflowName, stateName)
+	})
+}
+
+func (c *cachedClubHouse) GetWorkflowStateByID(stateID int) (ClubHouseWorkflowState, error) {
+	return cached("workflow_state", c.token+"\x00"+strconv.Itoa(stateID), func() (ClubHouseWorkflowState, error) {
+		return c.AbstractClubHouse.GetWorkflowStateByID(stateID)
+	})
+}
+
+func (c *cachedClubHouse) GetEpicByName(name string) (int, error) {
+	return cached("epic", c.token+"\x00"+name, func() (int, error) {
+		return c.AbstractClubHouse.GetEpicByName(name)
+	})
+}
+
+func (c *cachedClubHouse) GetMilestoneByName(name string) (int, error) {
+	return cached("milestone", c.token+"\x00"+name, func() (int, error) {
+		return c.AbstractClubHouse.GetMilestoneByName(name)
+	})
+}
+
+func (c *cachedClubHouse) ListCustomFields(fields *[]ClubHouseCustomField) error {
+	found, err := cached("custom_field", c.token, func() ([]ClubHouseCustomField, error) {
+		var fields []ClubHouseCustomField
+		err := c.AbstractClubHouse.ListCustomFields(&fields)
+		return fields, err
+	})
+	if err != nil {
+		return err
+	}
+	*fields = append([]ClubHouseCustomField{}, found...)
+	return nil
+}
+
+// GetMemberByEmail also caches emails of no member, as most requesters are
+// customers who would otherwise be looked up on every webhook
+func (c *cachedClubHouse) GetMemberByEmail(email string, member *ClubHouseMember) error {
+	found, err := cached("member", c.token+"\x00"+strings.ToLower(email), func() (*ClubHouseMember, error) {
+		var member = ClubHouseMember{}
+		err := c.AbstractClubHouse.GetMemberByEmail(email, &member)
+		if err == os.ErrNotExist {
+			return nil, nil
+		}
+		return &member, err
+	})
+	if err != nil {
+		return err
+	}
+	if found == nil {
+		return os.ErrNotExist
+	}
+	*member = *found
+	return nil
+}
@@ -3,14 +3,33 @@ package cloudfunction
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
+	"time"
 )
 
-const ClubHouseAPIURL string = "https://api.app.shortcut.com"
+// ErrStoryConflict is returned when several stories share the external ID of a
+// ticket, the adapter cannot tell which one to sync until they are merged
+var ErrStoryConflict = errors.New("several stories share the external ID")
+
+// ErrSearchLimit is returned by SearchStories when more stories match than
+// the search returns, see searchResultLimit
+var ErrSearchLimit = errors.New("more stories match than the search returns")
+
+// searchResultLimit is the most stories either search returns: the search API
+// stops handing out next tokens after 1000 results, the stories search
+// truncates its response there
+var searchResultLimit = 1000
+
+// ClubHouseAPIURL can be overridden by CLUBHOUSE_API_URL to run against a fake backend
+var ClubHouseAPIURL = getEnv("CLUBHOUSE_API_URL", "https://api.app.shortcut.com")
 
 type ClubHouseProject struct {
 	ID   int    `json:"id"`
@@ -36,10 +55,79 @@ type ClubHouseWorkflowState struct {
 	ID         int    `json:"id"`
 }
 
+type ClubHouseMemberProfile struct {
+	Name         string `json:"name"`
+	MentionName  string `json:"mention_name"`
+	EmailAddress string `json:"email_address"`
+}
+
+type ClubHouseMember struct {
+	ID       string                 `json:"id"`
+	Disabled bool                   `json:"disabled,omitempty"`
+	Profile  ClubHouseMemberProfile `json:"profile"`
+}
+
 type ClubHouseIteration struct {
-	ID     int    `json:"id"`
-	Status string `json:"status"`
-	Name   string `json:"name"`
+	ID        int      `json:"id"`
+	Status    string   `json:"status"`
+	Name      string   `json:"name"`
+	StartDate string   `json:"start_date,omitempty"`
+	EndDate   string   `json:"end_date,omitempty"`
+	GroupIDs  []string `json:"group_ids,omitempty"`
+}
+
+type ClubHouseEpic struct {
+	ID          int      `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	MilestoneID int      `json:"milestone_id,omitempty"`
+	GroupIDs    []string `json:"group_ids,omitempty"`
+}
+
+type ClubHouseMilestone struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// ClubHouseCustomField is the definition of a custom field, stories can only
+// take one of its enabled values
+type ClubHouseCustomField struct {
+	ID      string                      `json:"id"`
+	Name    string                      `json:"name"`
+	Enabled bool                        `json:"enabled"`
+	Values  []ClubHouseCustomFieldValue `json:"values"`
+}
+
+type ClubHouseCustomFieldValue struct {
+	ID      string `json:"id"`
+	Value   string `json:"value"`
+	Enabled bool   `json:"enabled"`
+}
+
+// ClubHouseLabel is a label of a story, stories are labeled by name
+type ClubHouseLabel struct {
+	ID   int    `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// ClubHouseTask is a checklist item of a story
+type ClubHouseTask struct {
+	ID          int    `json:"id,omitempty"`
+	Description string `json:"description"`
+	Complete    bool   `json:"complete"`
+}
+
+// ClubHouseStoryCustomField is the value a story takes for a custom field
+type ClubHouseStoryCustomField struct {
+	FieldID string `json:"field_id"`
+	ValueID string `json:"value_id"`
+	Value   string `json:"value,omitempty"`
+}
+
+// ClubHouseComment is a story comment, ExternalID keys it to its Zendesk comment
+type ClubHouseComment struct {
+	ID         int    `json:"id,omitempty"`
+	Text       string `json:"text"`
+	ExternalID string `json:"external_id,omitempty"`
 }
 
 type ClubHouseStory struct {
@@ -50,20 +138,48 @@ type ClubHouseStory struct {
 	Description     string   `json:"description"`
 	ExternalLinks   []string `json:"external_links"`
 	ExternalID      string   `json:"external_id"`
-	IterationID     int      `json:"iteration_id"`
+	IterationID     int      `json:"iteration_id,omitempty"`
 	WorkflowStateID int      `json:"workflow_state_id,omitempty"`
 	GroupID         string   `json:"group_id"`
+	EpicID          int      `json:"epic_id,omitempty"`
+	OwnerIDs        []string `json:"owner_ids,omitempty"`
+	FollowerIDs     []string `json:"follower_ids,omitempty"`
+	AppURL          string   `json:"app_url,omitempty"`
+	Archived        bool     `json:"archived,omitempty"`
+
+	Completed    bool                        `json:"completed,omitempty"`
+	CompletedAt  *time.Time                  `json:"completed_at,omitempty"`
+	Deadline     *time.Time                  `json:"deadline,omitempty"`
+	Labels       []ClubHouseLabel            `json:"labels,omitempty"`
+	CustomFields []ClubHouseStoryCustomField `json:"custom_fields,omitempty"`
+	Tasks        []ClubHouseTask             `json:"tasks,omitempty"`
+	Comments     []ClubHouseComment          `json:"comments,omitempty"`
 }
 
 type AbstractClubHouse interface {
 	CurrentIteration(*ClubHouseIteration) error
+	ListIterations(*[]ClubHouseIteration) error
 	GetStoryByExternalID(string, *ClubHouseStory) error
+	GetStory(int, *ClubHouseStory) error
 	GetWorkflowStateByName(string, string) (int, error)
 	GetProjectByName(string) (int, error)
 	GetTeamByName(string) (string, error)
 	CreateStory(*ClubHouseStory) error
 	AddCommentOnStory(int, string) error
+	CreateComment(int, *ClubHouseComment) error
 	UpdateStoryState(int, int) error
+	GetWorkflowStateByID(int) (ClubHouseWorkflowState, error)
+	GetIteration(int, *ClubHouseIteration) error
+	GetMember(string, *ClubHouseMember) error
+	GetMemberByEmail(string, *ClubHouseMember) error
+	UpdateStoryOwners(int, []string) error
+	GetEpicByName(string) (int, error)
+	CreateEpic(*ClubHouseEpic) error
+	GetMilestoneByName(string) (int, error)
+	SearchStories(string, *[]ClubHouseStory) error
+	GetProjectStories(int, *[]ClubHouseStory) error
+	ListCustomFields(*[]ClubHouseCustomField) error
+	UpdateStoryLabels(int, []ClubHouseLabel) error
 }
 
 type ClubHouse struct {
@@ -88,18 +204,7 @@ func (c *ClubHouse) CurrentIteration(currentIteration *ClubHouseIteration) error
 		return fmt.Errorf("no iteration provided")
 	}
 
-	URL := ClubHouseAPIURL + "/api/v3/iterations?token=" + c.Token
-	resp, err := http.Get(URL)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf(resp.Status)
-	}
-
-	err = json.NewDecoder(resp.Body).Decode(&iterations)
+	err := c.ListIterations(&iterations)
 	if err != nil {
 		return err
 	}
@@ -120,10 +225,34 @@ func (c *ClubHouse) CurrentIteration(currentIteration *ClubHouseIteration) error
 	return nil
 }
 
+func (c *ClubHouse) ListIterations(iterations *[]ClubHouseIteration) error {
+	if iterations == nil {
+		return fmt.Errorf("no iterations provided")
+	}
+
+	URL := ClubHouseAPIURL + "/api/v3/iterations?token=" + c.Token
+	resp, err := httpClient.Get(URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf(resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(iterations)
+}
+
 func (c *MockClubHouse) CurrentIteration(currentIteration *ClubHouseIteration) error {
 	return nil
 }
 
+func (c *MockClubHouse) ListIterations(iterations *[]ClubHouseIteration) error {
+	*iterations = []ClubHouseIteration{}
+	return nil
+}
+
 func (c *ClubHouse) CreateStory(story *ClubHouseStory) error {
 	if story == nil {
 		return fmt.Errorf("no story provided")
@@ -133,7 +262,7 @@ func (c *ClubHouse) CreateStory(story *ClubHouseStory) error {
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(URL, "application/json", bytes.NewBuffer(requestBytes))
+	resp, err := httpClient.Post(URL, "application/json", bytes.NewBuffer(requestBytes))
 	if err != nil {
 		return err
 	}
@@ -145,25 +274,39 @@ func (c *ClubHouse) CreateStory(story *ClubHouseStory) error {
 			return err
 		}
 		bodyString := string(bodyBytes)
-		log.Println(bodyString)
+		slog.Error("Clubhouse rejected story", "status", resp.Status, "response", bodyString)
 		return fmt.Errorf(resp.Status)
 	}
-	return nil
+
+	// The response carries the created story with its ID
+	return json.NewDecoder(resp.Body).Decode(story)
 }
 
 func (c *MockClubHouse) CreateStory(story *ClubHouseStory) error {
+	story.ID = 777
 	return nil
 }
 
 func (c *ClubHouse) AddCommentOnStory(storyID int, text string) error {
+	return c.CreateComment(storyID, &ClubHouseComment{Text: text})
+}
+
+func (c *MockClubHouse) AddCommentOnStory(storyID int, text string) error {
+	return c.CreateComment(storyID, &ClubHouseComment{Text: text})
+}
+
+func (c *ClubHouse) CreateComment(storyID int, comment *ClubHouseComment) error {
+	if comment == nil {
+		return fmt.Errorf("no comment provided")
+	}
+
 	URL := fmt.Sprintf("%s/api/v3/stories/%d/comments?token=%s", ClubHouseAPIURL, storyID, c.Token)
-	payload := map[string]interface{}{"text": text}
-	requestBytes, err := json.Marshal(payload)
+	requestBytes, err := json.Marshal(comment)
 	if err != nil {
 		return err
 	}
 
-	resp, err := http.Post(URL, "application/json", bytes.NewBuffer(requestBytes))
+	resp, err := httpClient.Post(URL, "application/json", bytes.NewBuffer(requestBytes))
 	if err != nil {
 		return err
 	}
@@ -172,10 +315,13 @@ func (c *ClubHouse) AddCommentOnStory(storyID int, text string) error {
 	if resp.StatusCode != 201 {
 		return fmt.Errorf(resp.Status)
 	}
-	return nil
+
+	// The response carries the created comment with its ID
+	return json.NewDecoder(resp.Body).Decode(comment)
 }
 
-func (c *MockClubHouse) AddCommentOnStory(storyID int, text string) error {
+func (c *MockClubHouse) CreateComment(storyID int, comment *ClubHouseComment) error {
+	comment.ID = 1
 	return nil
 }
 
@@ -192,7 +338,7 @@ func (c *ClubHouse) UpdateStoryState(storyID int, workflowID int) error {
 		return err
 	}
 	req.Header.Add("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -213,13 +359,56 @@ func (c *ClubHouse) GetStoryByExternalID(externalID string, story *ClubHouseStor
 		return fmt.Errorf("no story provided")
 	}
 
+	stories := []ClubHouseStory{}
+	err := c.storiesByExternalID(externalID, nil, nil, &stories)
+	if err != nil {
+		return err
+	}
+
+	// Archived stories only count when there is no other
+	var found, archived []ClubHouseStory
+	for _, candidate := range stories {
+		if candidate.Archived {
+			archived = append(archived, candidate)
+		} else {
+			found = append(found, candidate)
+		}
+	}
+	if len(found) == 0 {
+		found = archived
+	}
+	if len(found) == 0 {
+		return os.ErrNotExist
+	}
+	if len(found) > 1 {
+		return ErrStoryConflict
+	}
+
+	*story = found[0]
+	return nil
+}
+
+// searchEpoch is before the creation of any story, the start of the first split
+var searchEpoch = time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// storiesByExternalID collects the stories with an external ID, created between
+// from and to when set. The stories search has no next tokens and truncates at
+// searchResultLimit, so a full response is split in two by creation time until
+// every part fits
+func (c *ClubHouse) storiesByExternalID(externalID string, from, to *time.Time, stories *[]ClubHouseStory) error {
+	var found = []ClubHouseStory{}
+
 	URL := fmt.Sprintf("%s/api/v3/stories/search?token=%s", ClubHouseAPIURL, c.Token)
 	payload := map[string]interface{}{"external_id": externalID}
+	if from != nil && to != nil {
+		payload["created_at_start"] = from.Format(time.RFC3339Nano)
+		payload["created_at_end"] = to.Format(time.RFC3339Nano)
+	}
 	requestBytes, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(URL, "application/json", bytes.NewBuffer(requestBytes))
+	resp, err := httpClient.Post(URL, "application/json", bytes.NewBuffer(requestBytes))
 	if err != nil {
 		return err
 	}
@@ -228,24 +417,68 @@ func (c *ClubHouse) GetStoryByExternalID(externalID string, story *ClubHouseStor
 	if resp.StatusCode != 201 {
 		return fmt.Errorf(resp.Status)
 	}
+	err = json.NewDecoder(resp.Body).Decode(&found)
+	if err != nil {
+		return err
+	}
 
-	stories := []ClubHouseStory{}
-	err = json.NewDecoder(resp.Body).Decode(&stories)
+	if len(found) < searchResultLimit {
+		// Stories created right at a split come back from both halves
+		for _, story := range found {
+			if !slices.ContainsFunc(*stories, func(s ClubHouseStory) bool { return s.ID == story.ID }) {
+				*stories = append(*stories, story)
+			}
+		}
+		return nil
+	}
+	if from == nil || to == nil {
+		start, end := searchEpoch, time.Now().UTC().Add(time.Minute)
+		from, to = &start, &end
+	}
+	if to.Sub(*from) < time.Second {
+		return ErrSearchLimit
+	}
+	middle := from.Add(to.Sub(*from) / 2)
+	err = c.storiesByExternalID(externalID, from, &middle, stories)
 	if err != nil {
 		return err
 	}
-	if len(stories) == 0 {
+	return c.storiesByExternalID(externalID, &middle, to, stories)
+}
+
+func (c *MockClubHouse) GetStoryByExternalID(externalID string, story *ClubHouseStory) error {
+	if externalID == "zendesk-NON_EXIST_ID" || externalID == "zendesk-9999" {
 		return os.ErrNotExist
 	}
-
-	*story = stories[0]
+	story.ID = 777
+	story.ExternalID = externalID
 	return nil
 }
 
-func (c *MockClubHouse) GetStoryByExternalID(externalID string, story *ClubHouseStory) error {
-	if externalID == "zendesk-NON_EXIST_ID" {
+func (c *ClubHouse) GetStory(storyID int, story *ClubHouseStory) error {
+	if story == nil {
+		return fmt.Errorf("no story provided")
+	}
+
+	URL := fmt.Sprintf("%s/api/v3/stories/%d?token=%s", ClubHouseAPIURL, storyID, c.Token)
+	resp, err := httpClient.Get(URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
 		return os.ErrNotExist
 	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf(resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(story)
+}
+
+func (c *MockClubHouse) GetStory(storyID int, story *ClubHouseStory) error {
+	story.ID = storyID
 	return nil
 }
 
@@ -268,7 +501,7 @@ func (c *ClubHouse) GetWorkflowStateByName(workflowName string, stateName string
 	workflows := new([]ClubHoseWorkflow)
 	URL := fmt.Sprintf("%s/api/v3/workflows?token=%s", ClubHouseAPIURL, c.Token)
 
-	resp, err := http.Get(URL)
+	resp, err := httpClient.Get(URL)
 	if err != nil {
 		return 0, err
 	}
@@ -303,7 +536,7 @@ func (c *ClubHouse) GetProjectByName(name string) (int, error) {
 	projects := new([]ClubHouseProject)
 	URL := fmt.Sprintf("%s/api/v3/projects?token=%s", ClubHouseAPIURL, c.Token)
 
-	resp, err := http.Get(URL)
+	resp, err := httpClient.Get(URL)
 	if err != nil {
 		return 0, err
 	}
@@ -334,7 +567,7 @@ func (c *ClubHouse) GetTeamByName(name string) (string, error) {
 	teams := new([]ClubHouseGroup)
 	URL := fmt.Sprintf("%s/api/v3/groups?token=%s", ClubHouseAPIURL, c.Token)
 
-	resp, err := http.Get(URL)
+	resp, err := httpClient.Get(URL)
 	if err != nil {
 		return "", err
 	}
@@ -361,3 +594,414 @@ func (c *ClubHouse) GetTeamByName(name string) (string, error) {
 func (c *MockClubHouse) GetTeamByName(name string) (string, error) {
 	return "team-id", nil
 }
+
+func (c *ClubHouse) GetWorkflowStateByID(stateID int) (ClubHouseWorkflowState, error) {
+	workflows := new([]ClubHoseWorkflow)
+	URL := fmt.Sprintf("%s/api/v3/workflows?token=%s", ClubHouseAPIURL, c.Token)
+
+	resp, err := httpClient.Get(URL)
+	if err != nil {
+		return ClubHouseWorkflowState{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return ClubHouseWorkflowState{}, fmt.Errorf(resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&workflows)
+	if err != nil {
+		return ClubHouseWorkflowState{}, fmt.Errorf(resp.Status)
+	}
+
+	for _, workflow := range *workflows {
+		for _, state := range workflow.States {
+			if state.ID == stateID {
+				return state, nil
+			}
+		}
+	}
+
+	return ClubHouseWorkflowState{}, os.ErrNotExist
+}
+
+func (c *MockClubHouse) GetWorkflowStateByID(stateID int) (ClubHouseWorkflowState, error) {
+	return ClubHouseWorkflowState{ID: stateID, Name: "Created", Type: "unstarted"}, nil
+}
+
+func (c *ClubHouse) GetIteration(iterationID int, iteration *ClubHouseIteration) error {
+	if iteration == nil {
+		return fmt.Errorf("no iteration provided")
+	}
+
+	URL := fmt.Sprintf("%s/api/v3/iterations/%d?token=%s", ClubHouseAPIURL, iterationID, c.Token)
+	resp, err := httpClient.Get(URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return os.ErrNotExist
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf(resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(iteration)
+}
+
+func (c *MockClubHouse) GetIteration(iterationID int, iteration *ClubHouseIteration) error {
+	return nil
+}
+
+func (c *ClubHouse) GetMember(memberID string, member *ClubHouseMember) error {
+	if member == nil {
+		return fmt.Errorf("no member provided")
+	}
+
+	URL := fmt.Sprintf("%s/api/v3/members/%s?token=%s", ClubHouseAPIURL, memberID, c.Token)
+	resp, err := httpClient.Get(URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return os.ErrNotExist
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf(resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(member)
+}
+
+func (c *MockClubHouse) GetMember(memberID string, member *ClubHouseMember) error {
+	return nil
+}
+
+// GetMemberByEmail finds the active member with the email address, case insensitively
+func (c *ClubHouse) GetMemberByEmail(email string, member *ClubHouseMember) error {
+	var members []ClubHouseMember
+
+	if member == nil {
+		return fmt.Errorf("no member provided")
+	}
+
+	URL := fmt.Sprintf("%s/api/v3/members?token=%s", ClubHouseAPIURL, c.Token)
+	resp, err := httpClient.Get(URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf(resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&members)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		if !m.Disabled && strings.EqualFold(m.Profile.EmailAddress, email) {
+			*member = m
+			return nil
+		}
+	}
+	return os.ErrNotExist
+}
+
+func (c *MockClubHouse) GetMemberByEmail(email string, member *ClubHouseMember) error {
+	if email == "nobody@example.com" {
+		return os.ErrNotExist
+	}
+	member.ID = "member-" + email
+	member.Profile.EmailAddress = email
+	return nil
+}
+
+func (c *ClubHouse) UpdateStoryOwners(storyID int, ownerIDs []string) error {
+	URL := fmt.Sprintf("%s/api/v3/stories/%d?token=%s", ClubHouseAPIURL, storyID, c.Token)
+	payload := map[string]interface{}{"owner_ids": ownerIDs}
+	requestBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, URL, bytes.NewBuffer(requestBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf(resp.Status)
+	}
+	return nil
+}
+
+func (c *MockClubHouse) UpdateStoryOwners(storyID int, ownerIDs []string) error {
+	return nil
+}
+
+// UpdateStoryLabels replaces the labels of a story, missing labels are created by name
+func (c *ClubHouse) UpdateStoryLabels(storyID int, labels []ClubHouseLabel) error {
+	var names = []map[string]string{}
+	for _, label := range labels {
+		names = append(names, map[string]string{"name": label.Name})
+	}
+
+	URL := fmt.Sprintf("%s/api/v3/stories/%d?token=%s", ClubHouseAPIURL, storyID, c.Token)
+	payload := map[string]interface{}{"labels": names}
+	requestBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, URL, bytes.NewBuffer(requestBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return os.ErrNotExist
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf(resp.Status)
+	}
+	return nil
+}
+
+func (c *MockClubHouse) UpdateStoryLabels(storyID int, labels []ClubHouseLabel) error {
+	return nil
+}
+
+// searchPageSize is the largest page of the story search
+const searchPageSize = 25
+
+// SearchStories pages through all stories matching a Shortcut search query by
+// following the next tokens of the search results. When more stories match
+// than the search returns it fails with ErrSearchLimit before the first page,
+// GetProjectStories lists them all
+func (c *ClubHouse) SearchStories(query string, stories *[]ClubHouseStory) error {
+	var page struct {
+		Data  []ClubHouseStory `json:"data"`
+		Next  string           `json:"next"`
+		Total int              `json:"total"`
+	}
+
+	if stories == nil {
+		return fmt.Errorf("no stories provided")
+	}
+
+	URL := fmt.Sprintf("%s/api/v3/search/stories?query=%s&page_size=%d&token=%s",
+		ClubHouseAPIURL, url.QueryEscape(query), searchPageSize, c.Token)
+	for URL != "" {
+		resp, err := httpClient.Get(URL)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return fmt.Errorf(resp.Status)
+		}
+		page.Data, page.Next = nil, ""
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if page.Total > searchResultLimit {
+			return ErrSearchLimit
+		}
+
+		*stories = append(*stories, page.Data...)
+		URL = ""
+		if page.Next != "" {
+			// The next token comes as a path without the token
+			URL = fmt.Sprintf("%s%s&token=%s", ClubHouseAPIURL, page.Next, c.Token)
+		}
+	}
+	return nil
+}
+
+func (c *MockClubHouse) SearchStories(query string, stories *[]ClubHouseStory) error {
+	*stories = append(*stories,
+		ClubHouseStory{ID: 777, ProjectID: 55, ExternalID: "zendesk-7777", WorkflowStateID: 500000011},
+		ClubHouseStory{ID: 888, ProjectID: 55, ExternalID: "zendesk-8888", WorkflowStateID: 500000010},
+		ClubHouseStory{ID: 666, ProjectID: 55, ExternalID: "zendesk-6666", WorkflowStateID: 500000011},
+		ClubHouseStory{ID: 555, ProjectID: 55, Name: "Not from Zendesk"},
+	)
+	return nil
+}
+
+// GetProjectStories lists every story of a project, without the limit of the search
+func (c *ClubHouse) GetProjectStories(projectID int, stories *[]ClubHouseStory) error {
+	if stories == nil {
+		return fmt.Errorf("no stories provided")
+	}
+
+	URL := fmt.Sprintf("%s/api/v3/projects/%d/stories?token=%s", ClubHouseAPIURL, projectID, c.Token)
+	resp, err := httpClient.Get(URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return os.ErrNotExist
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf(resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(stories)
+}
+
+func (c *MockClubHouse) GetProjectStories(projectID int, stories *[]ClubHouseStory) error {
+	return c.SearchStories("", stories)
+}
+
+func (c *ClubHouse) GetEpicByName(name string) (int, error) {
+	epics := new([]ClubHouseEpic)
+	URL := fmt.Sprintf("%s/api/v3/epics?token=%s", ClubHouseAPIURL, c.Token)
+
+	resp, err := httpClient.Get(URL)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf(resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&epics)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, epic := range *epics {
+		if epic.Name == name {
+			return epic.ID, nil
+		}
+	}
+
+	return 0, os.ErrNotExist
+}
+
+func (c *MockClubHouse) GetEpicByName(name string) (int, error) {
+	if name == "NON_EXIST_EPIC" {
+		return 0, os.ErrNotExist
+	}
+	return 888, nil
+}
+
+func (c *ClubHouse) CreateEpic(epic *ClubHouseEpic) error {
+	if epic == nil {
+		return fmt.Errorf("no epic provided")
+	}
+
+	URL := fmt.Sprintf("%s/api/v3/epics?token=%s", ClubHouseAPIURL, c.Token)
+	requestBytes, err := json.Marshal(epic)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Post(URL, "application/json", bytes.NewBuffer(requestBytes))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 {
+		return fmt.Errorf(resp.Status)
+	}
+
+	// The response carries the created epic with its ID
+	return json.NewDecoder(resp.Body).Decode(epic)
+}
+
+func (c *MockClubHouse) CreateEpic(epic *ClubHouseEpic) error {
+	epic.ID = 999
+	return nil
+}
+
+func (c *ClubHouse) GetMilestoneByName(name string) (int, error) {
+	milestones := new([]ClubHouseMilestone)
+	URL := fmt.Sprintf("%s/api/v3/milestones?token=%s", ClubHouseAPIURL, c.Token)
+
+	resp, err := httpClient.Get(URL)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf(resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&milestones)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, milestone := range *milestones {
+		if milestone.Name == name {
+			return milestone.ID, nil
+		}
+	}
+
+	return 0, os.ErrNotExist
+}
+
+func (c *MockClubHouse) GetMilestoneByName(name string) (int, error) {
+	return 66, nil
+}
+
+func (c *ClubHouse) ListCustomFields(fields *[]ClubHouseCustomField) error {
+	if fields == nil {
+		return fmt.Errorf("no custom fields provided")
+	}
+
+	URL := fmt.Sprintf("%s/api/v3/custom-fields?token=%s", ClubHouseAPIURL, c.Token)
+	resp, err := httpClient.Get(URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf(resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(fields)
+}
+
+func (c *MockClubHouse) ListCustomFields(fields *[]ClubHouseCustomField) error {
+	*fields = []ClubHouseCustomField{
+		{ID: "field-tier", Name: "Customer Tier", Enabled: true, Values: []ClubHouseCustomFieldValue{
+			{ID: "tier-free", Value: "Free", Enabled: true},
+			{ID: "tier-pro", Value: "Pro", Enabled: true},
+			{ID: "tier-enterprise", Value: "Enterprise", Enabled: true},
+			{ID: "tier-legacy", Value: "Legacy", Enabled: false},
+		}},
+		{ID: "field-severity", Name: "Severity", Enabled: true, Values: []ClubHouseCustomFieldValue{
+			{ID: "severity-low", Value: "Low", Enabled: true},
+			{ID: "severity-high", Value: "High", Enabled: true},
+		}},
+		{ID: "field-area", Name: "Product Area", Enabled: false},
+	}
+	return nil
+}
@@ -1,8 +1,17 @@
 package cloudfunction
 
 import (
-	"github.com/jarcoal/httpmock"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
 )
 
 func TestClubHouse_CurrentIteration(t *testing.T) {
@@ -139,6 +148,38 @@ func TestClubHouse_GetStoryByExternalID(t *testing.T) {
 			expectID:     777,
 			wantErr:      false,
 		},
+		{
+			name:         "prefer the story not archived",
+			fields:       fields{"test"},
+			args:         args{"zendesk-777", new(ClubHouseStory)},
+			responseBody: `[{"id": 776, "archived": true}, {"id": 777}]`,
+			expectID:     777,
+			wantErr:      false,
+		},
+		{
+			name:         "archived story only",
+			fields:       fields{"test"},
+			args:         args{"zendesk-777", new(ClubHouseStory)},
+			responseBody: `[{"id": 776, "archived": true}]`,
+			expectID:     776,
+			wantErr:      false,
+		},
+		{
+			name:         "several stories share the external ID",
+			fields:       fields{"test"},
+			args:         args{"zendesk-777", new(ClubHouseStory)},
+			responseBody: `[{"id": 777}, {"id": 778}]`,
+			expectID:     0,
+			wantErr:      true,
+		},
+		{
+			name:         "no story",
+			fields:       fields{"test"},
+			args:         args{"zendesk-777", new(ClubHouseStory)},
+			responseBody: `[]`,
+			expectID:     0,
+			wantErr:      true,
+		},
 	}
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
@@ -188,7 +229,7 @@ func TestClubHouse_AddCommentOnStory(t *testing.T) {
 			c := &ClubHouse{
 				Token: tt.fields.Token,
 			}
-			httpmock.RegisterResponder("POST", `=~^https://api\.clubhouse\.io/api/v3/stories/.*/comments`,
+			httpmock.RegisterResponder("POST", "=~^"+regexp.QuoteMeta(ClubHouseAPIURL)+`/api/v3/stories/.*/comments`,
 				httpmock.NewStringResponder(201, `{}`))
 			if err := c.AddCommentOnStory(tt.args.storyID, tt.args.text); (err != nil) != tt.wantErr {
 				t.Errorf("AddCommentOnStory() error = %v, wantErr %v", err, tt.wantErr)
@@ -197,6 +238,63 @@ func TestClubHouse_AddCommentOnStory(t *testing.T) {
 	}
 }
 
+func TestClubHouse_CreateComment(t *testing.T) {
+	type fields struct {
+		Token string
+	}
+	type args struct {
+		storyID int
+		comment *ClubHouseComment
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    int
+		wantErr bool
+	}{
+		{
+			name:    "no comment obj",
+			fields:  fields{"test"},
+			args:    args{777, nil},
+			wantErr: true,
+		},
+		{
+			name:    "Create comment",
+			fields:  fields{"test"},
+			args:    args{777, &ClubHouseComment{Text: "Unit test", ExternalID: "zendesk-comment-1"}},
+			want:    42,
+			wantErr: false,
+		},
+	}
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClubHouse{
+				Token: tt.fields.Token,
+			}
+			httpmock.RegisterResponder("POST", "=~^"+regexp.QuoteMeta(ClubHouseAPIURL)+`/api/v3/stories/777/comments`,
+				func(req *http.Request) (*http.Response, error) {
+					var comment = ClubHouseComment{}
+					if err := json.NewDecoder(req.Body).Decode(&comment); err != nil || comment.ExternalID == "" {
+						return httpmock.NewStringResponse(400, `{}`), nil
+					}
+					comment.ID = 42
+					return httpmock.NewJsonResponse(201, comment)
+				})
+			err := c.CreateComment(tt.args.storyID, tt.args.comment)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateComment() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.args.comment != nil && tt.args.comment.ID != tt.want {
+				t.Errorf("CreateComment() got = %v, want %v", tt.args.comment.ID, tt.want)
+			}
+		})
+	}
+}
+
 func TestClubHouse_UpdateStoryState(t *testing.T) {
 	type fields struct {
 		Token string
@@ -225,7 +323,7 @@ func TestClubHouse_UpdateStoryState(t *testing.T) {
 			c := &ClubHouse{
 				Token: tt.fields.Token,
 			}
-			httpmock.RegisterResponder("PUT", `=~^https://api\.clubhouse\.io/api/v3/stories/.*`,
+			httpmock.RegisterResponder("PUT", "=~^"+regexp.QuoteMeta(ClubHouseAPIURL)+`/api/v3/stories/.*`,
 				httpmock.NewStringResponder(200, `{}`))
 			if err := c.UpdateStoryState(tt.args.storyID, tt.args.workflowID); (err != nil) != tt.wantErr {
 				t.Errorf("UpdateStoryState() error = %v, wantErr %v", err, tt.wantErr)
@@ -379,4 +477,586 @@ func TestClubHouse_GetProjectByName(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestClubHouse_GetWorkflowStateByID(t *testing.T) {
+	type fields struct {
+		Token string
+	}
+	type args struct {
+		stateID int
+	}
+	tests := []struct {
+		name         string
+		fields       fields
+		args         args
+		responseBody string
+		want         string
+		wantErr      bool
+	}{
+		{
+			name:         "Get workflow state by ID",
+			fields:       fields{"test"},
+			args:         args{123},
+			responseBody: workflowResponse,
+			want:         "completed",
+			wantErr:      false,
+		},
+		{
+			name:         "Non-exist workflow state",
+			fields:       fields{"test"},
+			args:         args{456},
+			responseBody: workflowResponse,
+			want:         "",
+			wantErr:      true,
+		},
+	}
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClubHouse{
+				Token: tt.fields.Token,
+			}
+			httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/workflows",
+				httpmock.NewStringResponder(200, tt.responseBody))
+			got, err := c.GetWorkflowStateByID(tt.args.stateID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetWorkflowStateByID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got.Name != tt.want {
+				t.Errorf("GetWorkflowStateByID() got = %v, want %v", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestClubHouse_GetMember(t *testing.T) {
+	type fields struct {
+		Token string
+	}
+	type args struct {
+		memberID string
+		member   *ClubHouseMember
+	}
+	tests := []struct {
+		name         string
+		fields       fields
+		args         args
+		status       int
+		responseBody string
+		want         string
+		wantErr      bool
+	}{
+		{
+			name:         "no member obj",
+			fields:       fields{"test"},
+			args:         args{"member-id", nil},
+			status:       200,
+			responseBody: `{}`,
+			wantErr:      true,
+		},
+		{
+			name:         "Get member",
+			fields:       fields{"test"},
+			args:         args{"member-id", new(ClubHouseMember)},
+			status:       200,
+			responseBody: `{"id": "member-id", "profile": {"name": "Jane Doe", "mention_name": "jane"}}`,
+			want:         "Jane Doe",
+			wantErr:      false,
+		},
+		{
+			name:         "Non-exist member",
+			fields:       fields{"test"},
+			args:         args{"member-id", new(ClubHouseMember)},
+			status:       404,
+			responseBody: `{}`,
+			wantErr:      true,
+		},
+	}
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClubHouse{
+				Token: tt.fields.Token,
+			}
+			httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/members/member-id",
+				httpmock.NewStringResponder(tt.status, tt.responseBody))
+			err := c.GetMember(tt.args.memberID, tt.args.member)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetMember() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.args.member != nil && tt.args.member.Profile.Name != tt.want {
+				t.Errorf("GetMember() got = %v, want %v", tt.args.member.Profile.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestClubHouse_SearchStories(t *testing.T) {
+	type fields struct {
+		Token string
+	}
+	type args struct {
+		query   string
+		stories *[]ClubHouseStory
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		status  int
+		want    []int
+		wantErr bool
+	}{
+		{
+			name:    "no stories obj",
+			fields:  fields{"test"},
+			args:    args{"project:Support", nil},
+			status:  200,
+			wantErr: true,
+		},
+		{
+			name:    "Follow the next pages",
+			fields:  fields{"test"},
+			args:    args{"project:Support", new([]ClubHouseStory)},
+			status:  200,
+			want:    []int{777, 888, 999},
+			wantErr: false,
+		},
+		{
+			name:    "Search failed",
+			fields:  fields{"test"},
+			args:    args{"project:Support", new([]ClubHouseStory)},
+			status:  400,
+			wantErr: true,
+		},
+	}
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClubHouse{
+				Token: tt.fields.Token,
+			}
+			httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/search/stories",
+				func(req *http.Request) (*http.Response, error) {
+					if tt.status != 200 {
+						return httpmock.NewStringResponse(tt.status, `{}`), nil
+					}
+					if req.URL.Query().Get("token") != tt.fields.Token {
+						return httpmock.NewStringResponse(401, `{}`), nil
+					}
+					switch req.URL.Query().Get("next") {
+					case "":
+						if req.URL.Query().Get("query") != tt.args.query {
+							return httpmock.NewStringResponse(400, `{}`), nil
+						}
+						return httpmock.NewStringResponse(200, `{"data": [{"id": 777}, {"id": 888}], "next": "/api/v3/search/stories?query=project%3ASupport&next=a1", "total": 3}`), nil
+					case "a1":
+						return httpmock.NewStringResponse(200, `{"data": [{"id": 999}], "next": null, "total": 3}`), nil
+					}
+					return httpmock.NewStringResponse(404, `{}`), nil
+				})
+			err := c.SearchStories(tt.args.query, tt.args.stories)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SearchStories() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.args.stories == nil || tt.wantErr {
+				return
+			}
+			var got []int
+			for _, story := range *tt.args.stories {
+				got = append(got, story.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchStories() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClubHouse_GetProjectStories(t *testing.T) {
+	type fields struct {
+		Token string
+	}
+	type args struct {
+		projectID int
+		stories   *[]ClubHouseStory
+	}
+	tests := []struct {
+		name         string
+		fields       fields
+		args         args
+		status       int
+		responseBody string
+		want         int
+		wantErr      bool
+	}{
+		{
+			name:         "no stories obj",
+			fields:       fields{"test"},
+			args:         args{55, nil},
+			status:       200,
+			responseBody: `[]`,
+			wantErr:      true,
+		},
+		{
+			name:         "Get project stories",
+			fields:       fields{"test"},
+			args:         args{55, new([]ClubHouseStory)},
+			status:       200,
+			responseBody: `[{"id": 777, "external_id": "zendesk-7777"}, {"id": 888}]`,
+			want:         2,
+			wantErr:      false,
+		},
+		{
+			name:         "Non-exist project",
+			fields:       fields{"test"},
+			args:         args{55, new([]ClubHouseStory)},
+			status:       404,
+			responseBody: `{}`,
+			wantErr:      true,
+		},
+	}
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClubHouse{
+				Token: tt.fields.Token,
+			}
+			httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/projects/55/stories",
+				httpmock.NewStringResponder(tt.status, tt.responseBody))
+			err := c.GetProjectStories(tt.args.projectID, tt.args.stories)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetProjectStories() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.args.stories != nil && len(*tt.args.stories) != tt.want {
+				t.Errorf("GetProjectStories() got = %v, want %v", len(*tt.args.stories), tt.want)
+			}
+		})
+	}
+}
+
+func TestClubHouse_SearchStories_limit(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/search/stories",
+		httpmock.NewStringResponder(200, `{"data": [{"id": 777}], "next": "/api/v3/search/stories?next=a1", "total": 1001}`))
+
+	stories := []ClubHouseStory{}
+	if err := (&ClubHouse{"test"}).SearchStories("project:Support", &stories); err != ErrSearchLimit {
+		t.Fatalf("SearchStories() error = %v, want %v", err, ErrSearchLimit)
+	}
+	if len(stories) != 0 {
+		t.Errorf("got %d stories, want none", len(stories))
+	}
+}
+
+// TestClubHouse_GetStoryByExternalID_split finds a story beyond the truncated
+// stories search by splitting the search by creation time
+func TestClubHouse_GetStoryByExternalID_split(t *testing.T) {
+	stories := []struct {
+		story   string
+		created time.Time
+	}{
+		{`{"id": 776, "archived": true}`, time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{`{"id": 775, "archived": true}`, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{`{"id": 777}`, time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	defer func(limit int) { searchResultLimit = limit }(searchResultLimit)
+	searchResultLimit = 2
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("POST", ClubHouseAPIURL+"/api/v3/stories/search",
+		func(req *http.Request) (*http.Response, error) {
+			var filter struct {
+				ExternalID string     `json:"external_id"`
+				Start      *time.Time `json:"created_at_start"`
+				End        *time.Time `json:"created_at_end"`
+			}
+			json.NewDecoder(req.Body).Decode(&filter)
+			var found []string
+			for _, s := range stories {
+				if (filter.Start == nil || !s.created.Before(*filter.Start)) && (filter.End == nil || !s.created.After(*filter.End)) {
+					found = append(found, s.story)
+				}
+			}
+			// Truncated like the real search
+			if len(found) > searchResultLimit {
+				found = found[:searchResultLimit]
+			}
+			return httpmock.NewStringResponse(201, "["+strings.Join(found, ",")+"]"), nil
+		})
+
+	story := ClubHouseStory{}
+	if err := (&ClubHouse{"test"}).GetStoryByExternalID("zendesk-777", &story); err != nil {
+		t.Fatal(err)
+	}
+	if story.ID != 777 {
+		t.Errorf("got story %d, want 777", story.ID)
+	}
+}
+
+func TestClubHouse_GetMemberByEmail(t *testing.T) {
+	membersResponse := `[
+  {"id": "disabled-id", "disabled": true, "profile": {"name": "Jane Doe", "email_address": "jane@example.com"}},
+  {"id": "member-id", "profile": {"name": "Jane Doe", "email_address": "Jane@Example.com"}}
+]`
+	tests := []struct {
+		name    string
+		email   string
+		member  *ClubHouseMember
+		status  int
+		want    string
+		wantErr bool
+	}{
+		{"no member obj", "jane@example.com", nil, 200, "", true},
+		{"Get member by email", "jane@example.com", new(ClubHouseMember), 200, "member-id", false},
+		{"Non-exist member", "john@example.com", new(ClubHouseMember), 200, "", true},
+		{"Server error", "jane@example.com", new(ClubHouseMember), 500, "", true},
+	}
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClubHouse{Token: "test"}
+			httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/members",
+				httpmock.NewStringResponder(tt.status, membersResponse))
+			err := c.GetMemberByEmail(tt.email, tt.member)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetMemberByEmail() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.member != nil && tt.member.ID != tt.want {
+				t.Errorf("GetMemberByEmail() got = %v, want %v", tt.member.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestClubHouse_UpdateStoryOwners(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("PUT", ClubHouseAPIURL+"/api/v3/stories/777",
+		func(req *http.Request) (*http.Response, error) {
+			var payload struct {
+				OwnerIDs []string `json:"owner_ids"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&payload); err != nil || len(payload.OwnerIDs) != 1 {
+				return httpmock.NewStringResponse(400, `{}`), nil
+			}
+			return httpmock.NewStringResponse(200, `{}`), nil
+		})
+
+	c := &ClubHouse{Token: "test"}
+	if err := c.UpdateStoryOwners(777, []string{"member-id"}); err != nil {
+		t.Errorf("UpdateStoryOwners() error = %v", err)
+	}
+}
+
+func TestClubHouse_UpdateStoryLabels(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("PUT", ClubHouseAPIURL+"/api/v3/stories/777",
+		func(req *http.Request) (*http.Response, error) {
+			var payload struct {
+				Labels []map[string]interface{} `json:"labels"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&payload); err != nil || len(payload.Labels) != 2 || len(payload.Labels[0]) != 1 || payload.Labels[1]["name"] != "sla-breached" {
+				return httpmock.NewStringResponse(400, `{}`), nil
+			}
+			return httpmock.NewStringResponse(200, `{}`), nil
+		})
+	httpmock.RegisterResponder("PUT", ClubHouseAPIURL+"/api/v3/stories/666",
+		httpmock.NewStringResponder(404, `{}`))
+
+	c := &ClubHouse{Token: "test"}
+	if err := c.UpdateStoryLabels(777, []ClubHouseLabel{{ID: 1, Name: "vip"}, {Name: "sla-breached"}}); err != nil {
+		t.Errorf("UpdateStoryLabels() error = %v", err)
+	}
+	if err := c.UpdateStoryLabels(666, nil); err != os.ErrNotExist {
+		t.Errorf("UpdateStoryLabels() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestClubHouse_Epics(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/epics",
+		httpmock.NewStringResponder(200, `[{"id": 888, "name": "Acme Escalations"}]`))
+	httpmock.RegisterResponder("POST", ClubHouseAPIURL+"/api/v3/epics",
+		httpmock.NewStringResponder(201, `{"id": 999, "name": "Globex", "milestone_id": 66}`))
+	httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/milestones",
+		httpmock.NewStringResponder(200, `[{"id": 66, "name": "Q3"}]`))
+
+	c := &ClubHouse{Token: "test"}
+	if id, err := c.GetEpicByName("Acme Escalations"); err != nil || id != 888 {
+		t.Errorf("GetEpicByName() got = %d %v, want 888", id, err)
+	}
+	if _, err := c.GetEpicByName("Globex"); err != os.ErrNotExist {
+		t.Errorf("GetEpicByName() error = %v, want %v", err, os.ErrNotExist)
+	}
+	if id, err := c.GetMilestoneByName("Q3"); err != nil || id != 66 {
+		t.Errorf("GetMilestoneByName() got = %d %v, want 66", id, err)
+	}
+	epic := ClubHouseEpic{Name: "Globex", MilestoneID: 66}
+	if err := c.CreateEpic(&epic); err != nil || epic.ID != 999 {
+		t.Errorf("CreateEpic() got = %d %v, want 999", epic.ID, err)
+	}
+	if err := c.CreateEpic(nil); err == nil {
+		t.Error("CreateEpic() without epic should fail")
+	}
+}
+
+func TestClubHouse_ListCustomFields(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	c := &ClubHouse{Token: "test"}
+	httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/custom-fields",
+		httpmock.NewStringResponder(200, `[{"id": "field-tier", "name": "Customer Tier", "enabled": true, "values": [{"id": "tier-pro", "value": "Pro", "enabled": true}]}]`))
+	fields := []ClubHouseCustomField{}
+	if err := c.ListCustomFields(&fields); err != nil || len(fields) != 1 || fields[0].Values[0].ID != "tier-pro" {
+		t.Errorf("ListCustomFields() got = %v %v", fields, err)
+	}
+	if err := c.ListCustomFields(nil); err == nil {
+		t.Error("ListCustomFields() without fields should fail")
+	}
+
+	httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/custom-fields",
+		httpmock.NewStringResponder(401, `{}`))
+	if err := c.ListCustomFields(&fields); err == nil {
+		t.Error("ListCustomFields() should fail on 401")
+	}
+}
+
+// recordingClubHouse is the MockClubHouse with reads set up by the test, it
+// records the writes the adapter sends to Clubhouse. Updates of the failing
+// story fail, as do lookups of the failing workflow state or iteration
+type recordingClubHouse struct {
+	MockClubHouse
+	story      ClubHouseStory                 // returned by GetStory with the requested ID
+	states     map[int]ClubHouseWorkflowState // workflow states by ID, the mock's otherwise
+	stateIDs   map[string]int                 // workflow state IDs by name, 0 for a missing state
+	iterations []ClubHouseIteration
+	members    map[string]ClubHouseMember // members by ID, others do not exist
+	current    int                        // ID of the current iteration
+	failing    int
+
+	epics    []ClubHouseEpic
+	comments []ClubHouseComment
+	owners   []string
+	labels   []ClubHouseLabel
+	moves    []int // workflow states stories were moved to
+}
+
+func (c *recordingClubHouse) fail(storyID int) error {
+	if c.failing != 0 && storyID == c.failing {
+		return fmt.Errorf("500 Internal Server Error")
+	}
+	return nil
+}
+
+func (c *recordingClubHouse) GetStory(storyID int, story *ClubHouseStory) error {
+	*story = c.story
+	story.ID = storyID
+	return nil
+}
+
+func (c *recordingClubHouse) GetWorkflowStateByID(stateID int) (ClubHouseWorkflowState, error) {
+	if err := c.fail(stateID); err != nil {
+		return ClubHouseWorkflowState{}, err
+	}
+	if state, ok := c.states[stateID]; ok {
+		return state, nil
+	}
+	return c.MockClubHouse.GetWorkflowStateByID(stateID)
+}
+
+func (c *recordingClubHouse) GetWorkflowStateByName(workflowName string, stateName string) (int, error) {
+	if stateID, ok := c.stateIDs[stateName]; ok {
+		if stateID == 0 {
+			return 0, os.ErrNotExist
+		}
+		return stateID, nil
+	}
+	return c.MockClubHouse.GetWorkflowStateByName(workflowName, stateName)
+}
+
+func (c *recordingClubHouse) ListIterations(iterations *[]ClubHouseIteration) error {
+	*iterations = append([]ClubHouseIteration{}, c.iterations...)
+	return nil
+}
+
+func (c *recordingClubHouse) GetIteration(iterationID int, iteration *ClubHouseIteration) error {
+	if err := c.fail(iterationID); err != nil {
+		return err
+	}
+	for _, existing := range c.iterations {
+		if existing.ID == iterationID {
+			*iteration = existing
+			return nil
+		}
+	}
+	return os.ErrNotExist
+}
+
+func (c *recordingClubHouse) GetMember(memberID string, member *ClubHouseMember) error {
+	existing, ok := c.members[memberID]
+	if !ok {
+		return os.ErrNotExist
+	}
+	*member = existing
+	return nil
+}
+
+func (c *recordingClubHouse) CurrentIteration(iteration *ClubHouseIteration) error {
+	iteration.ID = c.current
+	return nil
+}
+
+func (c *recordingClubHouse) CreateEpic(epic *ClubHouseEpic) error {
+	epic.ID = 999
+	c.epics = append(c.epics, *epic)
+	return nil
+}
+
+func (c *recordingClubHouse) CreateComment(storyID int, comment *ClubHouseComment) error {
+	if err := c.fail(storyID); err != nil {
+		return err
+	}
+	comment.ID = 1
+	c.comments = append(c.comments, *comment)
+	return nil
+}
+
+func (c *recordingClubHouse) UpdateStoryState(storyID int, stateID int) error {
+	if err := c.fail(storyID); err != nil {
+		return err
+	}
+	c.moves = append(c.moves, stateID)
+	return nil
+}
+
+func (c *recordingClubHouse) UpdateStoryOwners(storyID int, ownerIDs []string) error {
+	if err := c.fail(storyID); err != nil {
+		return err
+	}
+	c.owners = ownerIDs
+	return nil
+}
+
+func (c *recordingClubHouse) UpdateStoryLabels(storyID int, labels []ClubHouseLabel) error {
+	if err := c.fail(storyID); err != nil {
+		return err
+	}
+	c.labels = labels
+	return nil
+}
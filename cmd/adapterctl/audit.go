@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+
+	"cloudfunction"
+)
+
+func auditLog(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: audit <ticket-id>")
+	}
+
+	entries, err := cloudfunction.AuditLog().Query(args[0])
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s\t%s\tstory %d\t%s -> %s\tby %s\n",
+			entry.Time.Format("2006-01-02T15:04:05Z"), entry.Action, entry.StoryID, entry.Before, entry.After, entry.Actor)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"cloudfunction"
+)
+
+func backfill(args []string) error {
+	var options = cloudfunction.BackfillOptions{}
+
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	flags.StringVar(&options.Query, "query", "", "Zendesk search query of the tickets to import, e.g. \"status<solved\"")
+	flags.StringVar(&options.ViewID, "view", "", "Zendesk view of the tickets to import, instead of -query")
+	flags.Float64Var(&options.Rate, "rate", 1, "tickets to import per second, 0 for no limit")
+	flags.StringVar(&options.Checkpoint, "checkpoint", "backfill.checkpoint.json", "file to save progress to and resume from")
+	flags.IntVar(&options.Limit, "limit", 0, "tickets to import at most, 0 for all")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "report the stories that would be created without creating them")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if (options.Query == "") == (options.ViewID == "") {
+		return fmt.Errorf("either -query or -view is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cloudfunction.InitTracing(ctx, true)
+	defer cloudfunction.ShutdownTracing(context.Background())
+
+	zendesk, err := cloudfunction.NewZendesk(ctx)
+	if err != nil {
+		return fmt.Errorf("ZENDESK_SUBDOMAIN is required")
+	}
+
+	report, err := cloudfunction.Backfill(ctx, zendesk, options)
+	printErr := printJSON(report)
+	if err != nil {
+		return err
+	}
+	if printErr != nil {
+		return printErr
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d tickets failed", report.Failed, report.Processed)
+	}
+	return nil
+}
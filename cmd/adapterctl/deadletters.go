@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"cloudfunction"
+)
+
+func deadLetters(args []string) error {
+	var store = cloudfunction.DeadLetters()
+
+	if len(args) == 0 {
+		return fmt.Errorf("missing subcommand")
+	}
+
+	switch args[0] {
+	case "list":
+		deadLetters, err := store.List()
+		if err != nil {
+			return err
+		}
+		for _, letter := range deadLetters {
+			fmt.Printf("%s\t%s\t%s ticket %s\t%d attempts\t%s\n",
+				letter.Event.ID, letter.FailedAt.Format("2006-01-02T15:04:05Z"),
+				letter.Event.Action, letter.Event.Ticket.ID, letter.Event.Attempts, letter.Error)
+		}
+		return nil
+	case "show":
+		var deadLetter = cloudfunction.DeadLetter{}
+		if len(args) != 2 {
+			return fmt.Errorf("usage: show <id>")
+		}
+		err := store.Get(args[1], &deadLetter)
+		if err != nil {
+			return err
+		}
+		return printJSON(deadLetter)
+	case "replay":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: replay <id>")
+		}
+		return cloudfunction.ReplayDeadLetter(args[1])
+	case "replay-all":
+		deadLetters, err := store.List()
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, letter := range deadLetters {
+			err = cloudfunction.ReplayDeadLetter(letter.Event.ID)
+			if err != nil {
+				fmt.Printf("%s\tfailed: %s\n", letter.Event.ID, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s\treplayed\n", letter.Event.ID)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d dead letters failed again", failed, len(deadLetters))
+		}
+		return nil
+	case "delete":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: delete <id>")
+		}
+		return store.Delete(args[1])
+	}
+	return fmt.Errorf("unknown subcommand %q", args[0])
+}
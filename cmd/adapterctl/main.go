@@ -0,0 +1,67 @@
+// Command adapterctl runs maintenance tasks of the Zendesk Clubhouse adapter,
+// it is configured by the same environment variables as the adapter itself.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"cloudfunction"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"audit":        {"audit <ticket-id>", auditLog},
+	"backfill":     {"backfill -query <search>|-view <id> [-rate n] [-checkpoint file] [-limit n] [-dry-run]", backfill},
+	"dead-letters": {"dead-letters list|show <id>|replay <id>|replay-all|delete <id>", deadLetters},
+	"reconcile":    {"reconcile [-fix] [-rate n]", reconcile},
+	"sla-check":    {"sla-check [-window duration]", slaCheck},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: adapterctl <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	os.Exit(2)
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+
+	err := cloudfunction.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "adapterctl: %s\n", err)
+		os.Exit(1)
+	}
+
+	err = cmd.run(os.Args[2:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "adapterctl %s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"cloudfunction"
+)
+
+func reconcile(args []string) error {
+	var options = cloudfunction.ReconcileOptions{}
+
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	flags.BoolVar(&options.Fix, "fix", false, "move drifted stories to the state of their ticket")
+	flags.Float64Var(&options.Rate, "rate", 5, "tickets to check per second, 0 for no limit")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cloudfunction.InitTracing(ctx, true)
+	defer cloudfunction.ShutdownTracing(context.Background())
+
+	zendesk, err := cloudfunction.NewZendesk(ctx)
+	if err != nil {
+		return fmt.Errorf("ZENDESK_SUBDOMAIN is required")
+	}
+
+	report, err := cloudfunction.Reconcile(ctx, zendesk, options)
+	if err != nil {
+		return err
+	}
+	err = printJSON(report)
+	if err != nil {
+		return err
+	}
+	if drifted := len(report.Drifts) - report.Fixed; drifted > 0 {
+		return fmt.Errorf("%d of %d stories drifted from their ticket", drifted, report.Checked)
+	}
+	return nil
+}
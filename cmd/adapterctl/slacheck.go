@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"cloudfunction"
+)
+
+func slaCheck(args []string) error {
+	var options = cloudfunction.SLACheckOptions{}
+
+	flags := flag.NewFlagSet("sla-check", flag.ContinueOnError)
+	flags.DurationVar(&options.Window, "window", 0, "flag stories this long before their deadline, SLA_WARNING_WINDOW by default")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cloudfunction.InitTracing(ctx, true)
+	defer cloudfunction.ShutdownTracing(context.Background())
+
+	report, err := cloudfunction.CheckDeadlines(ctx, options)
+	if err != nil {
+		return err
+	}
+	err = printJSON(report)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, flag := range report.Flagged {
+		if flag.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d stories could not be flagged", failed, len(report.Flagged))
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Command server runs the Zendesk Clubhouse adapter as a standalone HTTP
+// server, for containers, VMs or local development against fake backends.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"cloudfunction"
+)
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// defaultAddr honours PORT as set by most container platforms
+func defaultAddr() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return getEnv("LISTEN_ADDR", ":8080")
+}
+
+func defaultWorkers() int {
+	workers, err := strconv.Atoi(getEnv("WORKERS", "4"))
+	if err != nil {
+		return 4
+	}
+	return workers
+}
+
+// fatal logs through the adapter's structured logger before exiting
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\n"))
+}
+
+func main() {
+	addr := flag.String("addr", defaultAddr(), "listen address")
+	tlsCert := flag.String("tls-cert", os.Getenv("TLS_CERT_FILE"), "TLS certificate file, enables HTTPS together with -tls-key")
+	tlsKey := flag.String("tls-key", os.Getenv("TLS_KEY_FILE"), "TLS private key file")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 15*time.Second, "time to wait for in-flight requests on shutdown")
+	queueKind := flag.String("queue", os.Getenv("QUEUE"), "process webhooks asynchronously through a memory or file queue")
+	queueDir := flag.String("queue-dir", getEnv("QUEUE_DIR", "queue"), "directory of the file queue")
+	workers := flag.Int("workers", defaultWorkers(), "number of queue workers")
+	maxAttempts := flag.Int("max-attempts", 3, "attempts per queued event before it becomes a dead letter")
+	retryDelay := flag.Duration("retry-delay", 2*time.Second, "delay before the first retry, growing with every attempt")
+	flag.Parse()
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fatal("Both -tls-cert and -tls-key must be set to enable TLS")
+	}
+	if err := cloudfunction.LoadConfig(); err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthz)
+	mux.Handle("/metrics", cloudfunction.MetricsHandler())
+	mux.HandleFunc("/", cloudfunction.ZendeskClubhouseAdapter)
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cloudfunction.InitTracing(ctx, true)
+	cloudfunction.InitMetrics(ctx, false)
+
+	var queue cloudfunction.Queue
+	var workerWg sync.WaitGroup
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	if *queueKind != "" {
+		var err error
+		queue, err = cloudfunction.QueueBuilder(*queueKind, *queueDir)
+		if err != nil {
+			fatal("Fail to open queue", "error", err)
+		}
+		cloudfunction.SetQueue(queue)
+
+		pool := &cloudfunction.WorkerPool{
+			Queue:       queue,
+			Workers:     *workers,
+			MaxAttempts: *maxAttempts,
+			RetryDelay:  *retryDelay,
+		}
+		workerWg.Add(1)
+		go func() {
+			defer workerWg.Done()
+			pool.Run(workerCtx)
+		}()
+		slog.Info("Processing webhooks asynchronously", "workers", *workers, "queue", *queueKind)
+	}
+
+	go func() {
+		var err error
+		slog.Info("Listening", "addr", *addr, "tls", *tlsCert != "")
+		if *tlsCert != "" {
+			err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Server error", "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	slog.Info("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fatal("Graceful shutdown failed", "error", err)
+	}
+
+	// Let the workers finish the events they already picked up, within what
+	// is left of the shutdown timeout
+	stopWorkers()
+	workersDone := make(chan struct{})
+	go func() {
+		workerWg.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Workers did not finish within the shutdown timeout", "timeout", *shutdownTimeout)
+	}
+	if queue != nil && queue.Len() > 0 {
+		slog.Warn("Queued events left unprocessed", "events", queue.Len())
+	}
+
+	// Spans get their own deadline, the shutdown timeout may be used up by now
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTracing()
+	if err := cloudfunction.ShutdownTracing(tracingCtx); err != nil {
+		slog.Warn("Fail to export remaining spans", "error", err)
+	}
+}
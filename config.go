@@ -0,0 +1,74 @@
+package cloudfunction
+
+import (
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Config is the configuration which has to be parsed from the environment.
+// It is parsed once at startup, so a mistake stops the start rather than
+// failing every webhook
+type Config struct {
+	CustomFields      map[string]customFieldMapping // CUSTOM_FIELDS
+	StoryName         *template.Template            // STORY_NAME_TEMPLATE
+	TaskTemplates     map[string][]string           // TASK_TEMPLATES
+	SLAOffsets        map[string]time.Duration      // SLA_PRIORITY_DEADLINES
+	EpicRules         []epicRule                    // EPIC_RULES
+	Redactor          *Redactor                     // REDACT_DETECTORS and REDACT_PATTERNS
+	IterationStrategy string                        // CLUBHOUSE_ITERATION_STRATEGY
+}
+
+var loadedConfig atomic.Pointer[Config]
+
+// LoadConfig parses the configuration from the environment. The server and
+// adapterctl call it at startup and exit on errors, functions call it on
+// their first request, see currentConfig
+func LoadConfig() error {
+	var config = Config{}
+	var err error
+
+	config.CustomFields, err = customFieldMappings()
+	if err != nil {
+		return err
+	}
+	config.StoryName, err = storyNameTemplate()
+	if err != nil {
+		return err
+	}
+	config.TaskTemplates, err = taskTemplates()
+	if err != nil {
+		return err
+	}
+	config.SLAOffsets, err = slaPriorityOffsets()
+	if err != nil {
+		return err
+	}
+	config.EpicRules, err = epicRules()
+	if err != nil {
+		return err
+	}
+	config.Redactor, err = newRedactor()
+	if err != nil {
+		return err
+	}
+	config.IterationStrategy, err = iterationStrategy()
+	if err != nil {
+		return err
+	}
+
+	loadedConfig.Store(&config)
+	return nil
+}
+
+// currentConfig is the loaded configuration, it is loaded on first use
+func currentConfig() (*Config, error) {
+	if config := loadedConfig.Load(); config != nil {
+		return config, nil
+	}
+	err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return loadedConfig.Load(), nil
+}
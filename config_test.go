@@ -0,0 +1,62 @@
+package cloudfunction
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// setConfig sets an environment variable for the test and reloads the
+// configuration, which is reloaded again once the variable is restored
+func setConfig(t *testing.T, key string, value string) error {
+	t.Helper()
+	t.Cleanup(func() { LoadConfig() })
+	t.Setenv(key, value)
+	return LoadConfig()
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := map[string]struct {
+		key     string
+		value   string
+		wantErr bool
+	}{
+		"custom fields":         {"CUSTOM_FIELDS", `{"Customer Tier": {"from": "tag:tier_"}}`, false},
+		"invalid custom fields": {"CUSTOM_FIELDS", `{"Customer Tier": "tier"}`, true},
+		"story name":            {"STORY_NAME_TEMPLATE", `{{value "priority"}}: {{.Title}}`, false},
+		"invalid story name":    {"STORY_NAME_TEMPLATE", `{{.Title`, true},
+		"task templates":        {"TASK_TEMPLATES", `{"*": ["Link the Zendesk ticket"]}`, false},
+		"invalid task match":    {"TASK_TEMPLATES", `{"team:Support": ["Triage"]}`, true},
+		"SLA offsets":           {"SLA_PRIORITY_DEADLINES", "urgent=4h,high=24h", false},
+		"invalid SLA offset":    {"SLA_PRIORITY_DEADLINES", "urgent=soon", true},
+		"epic rules":            {"EPIC_RULES", "org:Acme=Acme Escalations", false},
+		"invalid epic rule":     {"EPIC_RULES", "team:Support=Support", true},
+		"redaction pattern":     {"REDACT_PATTERNS", `{"contract": "ACME-\\d{4}"}`, false},
+		"invalid redaction":     {"REDACT_PATTERNS", `{"contract": "ACME-("}`, true},
+		"iteration strategy":    {"CLUBHOUSE_ITERATION_STRATEGY", "Next-Upcoming", false},
+		"unknown iteration":     {"CLUBHOUSE_ITERATION_STRATEGY", "latest", true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := setConfig(t, tt.key, tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestZendeskClubhouseAdapter_InvalidConfig(t *testing.T) {
+	os.Setenv("AUTH_USER", "")
+	os.Setenv("AUTH_PASSWORD", "")
+	t.Cleanup(func() { LoadConfig() })
+	t.Setenv("CUSTOM_FIELDS", `{"Customer Tier": "tier"}`)
+	loadedConfig.Store(nil)
+
+	w := httptest.NewRecorder()
+	ZendeskClubhouseAdapter(w, httptest.NewRequest(http.MethodGet, "/tickets/7777", nil))
+	if s := w.Result().StatusCode; s != http.StatusInternalServerError {
+		t.Fatalf("got: %d, want: %d", s, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,111 @@
+package cloudfunction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// customFieldMapping fills a Shortcut custom field from the ticket value From,
+// Values renames ticket values to field values and Default applies when the
+// ticket has no value
+type customFieldMapping struct {
+	From    string            `json:"from"`
+	Values  map[string]string `json:"values"`
+	Default string            `json:"default"`
+}
+
+// customFieldMappings parses CUSTOM_FIELDS, a JSON object of Shortcut custom
+// field names to their mapping
+func customFieldMappings() (map[string]customFieldMapping, error) {
+	var mappings map[string]customFieldMapping
+
+	config := getEnv("CUSTOM_FIELDS", "")
+	if config == "" {
+		return nil, nil
+	}
+	err := json.Unmarshal([]byte(config), &mappings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CUSTOM_FIELDS: %w", err)
+	}
+	for name, mapping := range mappings {
+		if mapping.From == "" && mapping.Default == "" {
+			return nil, fmt.Errorf("custom field %s has neither from nor default", name)
+		}
+	}
+	return mappings, nil
+}
+
+// mappedValue is the field value of a ticket value, ticket values are matched case insensitively
+func (m customFieldMapping) mappedValue(value string) string {
+	if value == "" {
+		return m.Default
+	}
+	for from, to := range m.Values {
+		if strings.EqualFold(from, value) {
+			return to
+		}
+	}
+	return value
+}
+
+// fieldValue is the enabled value of the field matching value case insensitively
+func fieldValue(field *ClubHouseCustomField, value string) (ClubHouseCustomFieldValue, bool) {
+	for _, v := range field.Values {
+		if v.Enabled && strings.EqualFold(v.Value, value) {
+			return v, true
+		}
+	}
+	return ClubHouseCustomFieldValue{}, false
+}
+
+// storyCustomFields are the custom field values of the story of a ticket per
+// the mappings of CUSTOM_FIELDS. Unknown or disabled fields and values outside
+// of the field's enum are left unset with a warning rather than failing the story
+func storyCustomFields(ctx context.Context, clubhouse AbstractClubHouse, zendeskTicket *ZendeskTicket, mappings map[string]customFieldMapping) ([]ClubHouseStoryCustomField, error) {
+	var storyFields []ClubHouseStoryCustomField
+	var fields []ClubHouseCustomField
+
+	if len(mappings) == 0 {
+		return nil, nil
+	}
+	err := clubhouse.ListCustomFields(&fields)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(mappings))
+	for name := range mappings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		mapping := mappings[name]
+		value := mapping.mappedValue(ticketValue(zendeskTicket, mapping.From))
+		if value == "" {
+			continue
+		}
+
+		var field *ClubHouseCustomField
+		for i := range fields {
+			if strings.EqualFold(fields[i].Name, name) {
+				field = &fields[i]
+				break
+			}
+		}
+		if field == nil || !field.Enabled {
+			loggerFrom(ctx).Warn("Custom field not found", "field", name)
+			continue
+		}
+		fieldValue, ok := fieldValue(field, value)
+		if !ok {
+			loggerFrom(ctx).Warn("Custom field value not allowed", "field", name, "value", value)
+			continue
+		}
+		storyFields = append(storyFields, ClubHouseStoryCustomField{FieldID: field.ID, ValueID: fieldValue.ID, Value: fieldValue.Value})
+	}
+	return storyFields, nil
+}
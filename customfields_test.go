@@ -0,0 +1,61 @@
+package cloudfunction
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func Test_storyCustomFields(t *testing.T) {
+	tests := map[string]struct {
+		config  string
+		ticket  ZendeskTicket
+		want    []ClubHouseStoryCustomField
+		wantErr bool
+	}{
+		"no mapping": {"", ZendeskTicket{Tags: []string{"tier_pro"}}, nil, false},
+		"tag value": {
+			`{"Customer Tier": {"from": "tag:tier_"}}`,
+			ZendeskTicket{Tags: []string{"urgent", "Tier_Pro"}},
+			[]ClubHouseStoryCustomField{{FieldID: "field-tier", ValueID: "tier-pro", Value: "Pro"}},
+			false,
+		},
+		"renamed value": {
+			`{"Customer Tier": {"from": "org", "values": {"InfuseAI": "enterprise"}}}`,
+			ZendeskTicket{Organization: "infuseai"},
+			[]ClubHouseStoryCustomField{{FieldID: "field-tier", ValueID: "tier-enterprise", Value: "Enterprise"}},
+			false,
+		},
+		"default value": {
+			`{"Customer Tier": {"from": "tag:tier_", "default": "Free"}, "Severity": {"from": "tag:severity_"}}`,
+			ZendeskTicket{},
+			[]ClubHouseStoryCustomField{{FieldID: "field-tier", ValueID: "tier-free", Value: "Free"}},
+			false,
+		},
+		"value not allowed": {`{"Customer Tier": {"from": "tag:tier_"}}`, ZendeskTicket{Tags: []string{"tier_gold"}}, nil, false},
+		"disabled value":    {`{"Customer Tier": {"from": "tag:tier_"}}`, ZendeskTicket{Tags: []string{"tier_legacy"}}, nil, false},
+		"disabled field":    {`{"Product Area": {"default": "Billing"}}`, ZendeskTicket{}, nil, false},
+		"unknown field":     {`{"Region": {"default": "EU"}}`, ZendeskTicket{}, nil, false},
+		"invalid config":    {`{"Customer Tier": "tier"}`, ZendeskTicket{}, nil, true},
+		"no source":         {`{"Customer Tier": {}}`, ZendeskTicket{}, nil, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := setConfig(t, "CUSTOM_FIELDS", tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, err := storyCustomFields(context.Background(), &MockClubHouse{}, &tt.ticket, loadedConfig.Load().CustomFields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
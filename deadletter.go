@@ -0,0 +1,186 @@
+package cloudfunction
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeadLetter is an event which could not be synced to Clubhouse
+type DeadLetter struct {
+	Event    Event     `json:"event"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type DeadLetterStore interface {
+	Put(*DeadLetter) error
+	Get(string, *DeadLetter) error
+	List() ([]DeadLetter, error)
+	Delete(string) error
+}
+
+// FileDeadLetterStore keeps one JSON file per dead letter in Dir
+type FileDeadLetterStore struct {
+	Dir string
+}
+
+func DeadLetterStoreBuilder(dir string) DeadLetterStore {
+	return &FileDeadLetterStore{dir}
+}
+
+var deadLetterDirOnce sync.Once
+
+// DeadLetters returns the store configured by DEAD_LETTER_DIR. Without it dead
+// letters go to dead-letters in the working directory, never to a temporary
+// directory which is wiped with the instance
+func DeadLetters() DeadLetterStore {
+	dir := os.Getenv("DEAD_LETTER_DIR")
+	if dir == "" {
+		dir = "dead-letters"
+		deadLetterDirOnce.Do(func() {
+			slog.Warn("DEAD_LETTER_DIR is not set, dead letters are stored in the working directory", "dir", dir)
+		})
+	}
+	return DeadLetterStoreBuilder(dir)
+}
+
+func (s *FileDeadLetterStore) path(id string) string {
+	return filepath.Join(s.Dir, filepath.Base(id)+".json")
+}
+
+func (s *FileDeadLetterStore) Put(deadLetter *DeadLetter) error {
+	err := os.MkdirAll(s.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(deadLetter, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := s.path(deadLetter.Event.ID)
+	err = os.WriteFile(path+".tmp", data, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (s *FileDeadLetterStore) Get(id string, deadLetter *DeadLetter) error {
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return os.ErrNotExist
+		}
+		return err
+	}
+	return json.Unmarshal(data, deadLetter)
+}
+
+// List returns the dead letters, oldest failure first
+func (s *FileDeadLetterStore) List() ([]DeadLetter, error) {
+	deadLetters := []DeadLetter{}
+
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		var deadLetter = DeadLetter{}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(data, &deadLetter)
+		if err != nil {
+			slog.Error("Skip broken dead letter", "file", file, "error", err)
+			continue
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].FailedAt.Before(deadLetters[j].FailedAt)
+	})
+	return deadLetters, nil
+}
+
+func (s *FileDeadLetterStore) Delete(id string) error {
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return os.ErrNotExist
+	}
+	return err
+}
+
+// isRetryable tells failures worth retrying from payloads which can never
+// succeed and stories or members which do not exist
+func isRetryable(err error) bool {
+	return err != nil && err != os.ErrInvalid && err != os.ErrNotExist && err != ErrStoryConflict
+}
+
+// needsDeadLetter tells failures to keep for replay, conflicts are kept as they
+// succeed once the duplicated stories are merged
+func needsDeadLetter(err error) bool {
+	return err != nil && err != os.ErrInvalid
+}
+
+// deadLetter persists a failed event, so it can be replayed later
+func deadLetter(ctx context.Context, event *Event, err error) {
+	logger := loggerFrom(ctx).With("event_id", event.ID, "ticket_id", event.Ticket.ID)
+	deadLetter := &DeadLetter{
+		Event:    *event,
+		Error:    err.Error(),
+		FailedAt: time.Now().UTC(),
+	}
+	if putErr := DeadLetters().Put(deadLetter); putErr != nil {
+		logger.Error("Fail to store dead letter", "error", putErr)
+		return
+	}
+	logger.Warn("Dead letter stored", "attempts", event.Attempts, "error", err)
+}
+
+// ReplayDeadLetter sends a dead letter through the normal pipeline again, it is
+// removed on success and updated with the new error on failure
+func ReplayDeadLetter(id string) error {
+	var store = DeadLetters()
+	var letter = DeadLetter{}
+
+	err := store.Get(id, &letter)
+	if err != nil {
+		return err
+	}
+
+	// A replay starts over, with all its attempts and behind the queued events
+	event := letter.Event
+	event.Actor = "replay"
+	event.Attempts = 0
+	event.EnqueuedAt = time.Now().UTC()
+	if eventQueue != nil {
+		err = eventQueue.Enqueue(&event)
+		if err != nil {
+			return err
+		}
+		return store.Delete(id)
+	}
+
+	event.Attempts++
+	err = ProcessEvent(context.Background(), &event)
+	if err != nil {
+		letter.Event = event
+		letter.Error = err.Error()
+		letter.FailedAt = time.Now().UTC()
+		if putErr := store.Put(&letter); putErr != nil {
+			slog.Error("Fail to update dead letter", "event_id", id, "error", putErr)
+		}
+		return err
+	}
+	return store.Delete(id)
+}
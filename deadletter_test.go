@@ -0,0 +1,229 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileDeadLetterStore(t *testing.T) {
+	store := DeadLetterStoreBuilder(t.TempDir())
+	event := NewEvent(ActionUpdate, ZendeskTicket{ID: "7777"})
+
+	if err := store.Put(&DeadLetter{Event: *event, Error: "503 Service Unavailable"}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadLetters, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Event.ID != event.ID {
+		t.Fatalf("got %v, want one dead letter %s", deadLetters, event.ID)
+	}
+
+	var deadLetter = DeadLetter{}
+	if err := store.Get(event.ID, &deadLetter); err != nil {
+		t.Fatal(err)
+	}
+	if deadLetter.Error != "503 Service Unavailable" {
+		t.Fatalf("got: %s, want: 503 Service Unavailable", deadLetter.Error)
+	}
+
+	if err := store.Delete(event.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Get(event.ID, &deadLetter); err != os.ErrNotExist {
+		t.Fatalf("got: %v, want: %v", err, os.ErrNotExist)
+	}
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	tests := map[string]struct {
+		ticketID     string
+		wantErr      bool
+		wantAttempts int
+	}{
+		"replay succeeds":  {"7777", false, 0},
+		"replay fails":     {"NON_EXIST_ID", true, 1},
+		"non-exist letter": {"", true, 0},
+	}
+
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("DEAD_LETTER_DIR", t.TempDir())
+			event := NewEvent(ActionUpdate, ZendeskTicket{ID: tt.ticketID, Description: "Hello world"})
+			event.Attempts = 3
+			if tt.ticketID != "" {
+				DeadLetters().Put(&DeadLetter{Event: *event, Error: "503 Service Unavailable"})
+			}
+
+			if err := ReplayDeadLetter(event.ID); (err != nil) != tt.wantErr {
+				t.Fatalf("ReplayDeadLetter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var deadLetter = DeadLetter{}
+			err := DeadLetters().Get(event.ID, &deadLetter)
+			if tt.wantAttempts == 0 {
+				if err != os.ErrNotExist {
+					t.Fatalf("dead letter should be removed, got: %v", err)
+				}
+				return
+			}
+			if deadLetter.Event.Attempts != tt.wantAttempts {
+				t.Fatalf("got %d attempts, want %d", deadLetter.Event.Attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestReplayDeadLetter_queued(t *testing.T) {
+	t.Setenv("DEAD_LETTER_DIR", t.TempDir())
+	queue := NewMemoryQueue()
+	SetQueue(queue)
+	defer SetQueue(nil)
+	event := NewEvent(ActionUpdate, ZendeskTicket{ID: "7777", Description: "Hello world"})
+	event.Attempts = 3
+	event.EnqueuedAt = event.EnqueuedAt.Add(-time.Hour)
+	DeadLetters().Put(&DeadLetter{Event: *event, Error: "503 Service Unavailable"})
+
+	if err := ReplayDeadLetter(event.ID); err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := queue.Dequeue(canceledContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Attempts != 0 || !replayed.EnqueuedAt.After(event.EnqueuedAt.Add(time.Hour-time.Second)) {
+		t.Fatalf("got %d attempts enqueued at %s, want a fresh event", replayed.Attempts, replayed.EnqueuedAt)
+	}
+}
+
+// failAction makes every event of the action fail with a retryable error
+// until the test ends
+func failAction(t *testing.T, action string) {
+	t.Helper()
+	previous := eventActions[action]
+	t.Cleanup(func() { eventActions[action] = previous })
+	eventActions[action] = func(context.Context, *ZendeskTicket) error {
+		return fmt.Errorf("503 Service Unavailable")
+	}
+}
+
+func TestWorkerPool_DeadLetter(t *testing.T) {
+	tests := map[string]struct {
+		ticketID     string
+		failing      bool
+		wantAttempts int
+	}{
+		"retried":       {"7777", true, 3},
+		"missing story": {"NON_EXIST_ID", false, 1},
+	}
+
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("DEAD_LETTER_DIR", t.TempDir())
+			if tt.failing {
+				failAction(t, ActionClose)
+			}
+			queue := NewMemoryQueue()
+			pool := &WorkerPool{Queue: queue, Workers: 1, MaxAttempts: 3}
+			event := NewEvent(ActionClose, ZendeskTicket{ID: tt.ticketID})
+
+			pool.handle(context.Background(), event)
+
+			var deadLetter = DeadLetter{}
+			if err := DeadLetters().Get(event.ID, &deadLetter); err != nil {
+				t.Fatal(err)
+			}
+			if deadLetter.Event.Attempts != tt.wantAttempts {
+				t.Fatalf("got %d attempts, want %d", deadLetter.Event.Attempts, tt.wantAttempts)
+			}
+			if _, err := queue.Dequeue(canceledContext()); err == nil {
+				t.Fatal("dead letter should not stay in the queue")
+			}
+		})
+	}
+}
+
+func TestWorkerPool_InvalidEvent(t *testing.T) {
+	t.Setenv("DEAD_LETTER_DIR", t.TempDir())
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	queue := NewMemoryQueue()
+	pool := &WorkerPool{Queue: queue, Workers: 1, MaxAttempts: 3}
+	event := NewEvent("merge", ZendeskTicket{ID: "7777"})
+
+	pool.handle(context.Background(), event)
+
+	if event.Attempts != 1 {
+		t.Fatalf("got %d attempts, want 1", event.Attempts)
+	}
+	if deadLetters, _ := DeadLetters().List(); len(deadLetters) != 0 {
+		t.Fatalf("got %d dead letters, invalid events are never replayed", len(deadLetters))
+	}
+}
+
+func TestDeadLetterAdmin(t *testing.T) {
+	t.Setenv("DEAD_LETTER_DIR", t.TempDir())
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	os.Setenv("AUTH_USER", "")
+	os.Setenv("AUTH_PASSWORD", "")
+
+	// Without credentials the admin routes are open to anyone, so they are refused
+	w := httptest.NewRecorder()
+	ZendeskClubhouseAdapter(w, httptest.NewRequest(http.MethodGet, "/admin/dead-letters", nil))
+	if s := w.Result().StatusCode; s != http.StatusForbidden {
+		t.Fatalf("got: %d, want: %d", s, http.StatusForbidden)
+	}
+
+	t.Setenv("AUTH_USER", "admin")
+	t.Setenv("AUTH_PASSWORD", "YouShallNotPass!")
+
+	// A failing webhook leaves a dead letter behind
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/tickets/NON_EXIST_ID/comments", bytes.NewBuffer([]byte(`{"description": "Hello world"}`)))
+	r.SetBasicAuth("admin", "YouShallNotPass!")
+	ZendeskClubhouseAdapter(w, r)
+	if s := w.Result().StatusCode; s != http.StatusNotFound {
+		t.Fatalf("got: %d, want: %d", s, http.StatusNotFound)
+	}
+	deadLetters, _ := DeadLetters().List()
+	if len(deadLetters) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(deadLetters))
+	}
+	id := deadLetters[0].Event.ID
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{http.MethodGet, "/admin/dead-letters", http.StatusOK},
+		{http.MethodGet, "/admin/dead-letters/" + id, http.StatusOK},
+		{http.MethodPost, "/admin/dead-letters/" + id + "/replay", http.StatusNotFound},
+		{http.MethodDelete, "/admin/dead-letters/" + id, http.StatusNoContent},
+		{http.MethodGet, "/admin/dead-letters/" + id, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		r.SetBasicAuth("admin", "YouShallNotPass!")
+		ZendeskClubhouseAdapter(w, r)
+		if s := w.Result().StatusCode; s != tt.wantStatus {
+			t.Fatalf("%s %s got: %d, want: %d", tt.method, tt.path, s, tt.wantStatus)
+		}
+	}
+}
+
+func canceledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
@@ -0,0 +1,133 @@
+package cloudfunction
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// DryRunPlan collects the writes a request would have sent to Clubhouse
+type DryRunPlan struct {
+	Action          string            `json:"action"`
+	TicketID        string            `json:"ticket_id"`
+	Story           *ClubHouseStory   `json:"story,omitempty"`
+	Epic            *ClubHouseEpic    `json:"epic,omitempty"`
+	Comments        []DryRunComment   `json:"comments,omitempty"`
+	StateTransition *DryRunTransition `json:"state_transition,omitempty"`
+	OwnerIDs        []string          `json:"owner_ids,omitempty"`
+	Labels          []ClubHouseLabel  `json:"labels,omitempty"`
+	StaleMapping    int               `json:"stale_mapping,omitempty"`
+	Audit           []AuditEntry      `json:"audit"`
+
+	mu sync.Mutex
+}
+
+// dropMapping records the mapping a request would have deleted
+func (p *DryRunPlan) dropMapping(storyID int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.StaleMapping = storyID
+}
+
+type DryRunComment struct {
+	StoryID    int    `json:"story_id"`
+	Text       string `json:"text"`
+	ExternalID string `json:"external_id,omitempty"`
+}
+
+type DryRunTransition struct {
+	StoryID int    `json:"story_id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	ToID    int    `json:"to_id"`
+}
+
+// isDryRun tells whether a request only reports its changes, per X-Dry-Run
+// header or for all requests by DRY_RUN. The header can only turn dry runs
+// on, an environment with DRY_RUN set never writes
+func isDryRun(r *http.Request) bool {
+	if dryRun, _ := strconv.ParseBool(os.Getenv("DRY_RUN")); dryRun {
+		return true
+	}
+	dryRun, _ := strconv.ParseBool(r.Header.Get("X-Dry-Run"))
+	return dryRun
+}
+
+type dryRunKey struct{}
+
+func withDryRun(ctx context.Context, plan *DryRunPlan) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, plan)
+}
+
+func dryRunPlanFrom(ctx context.Context) *DryRunPlan {
+	plan, _ := ctx.Value(dryRunKey{}).(*DryRunPlan)
+	return plan
+}
+
+// dryRunClubHouse reads from Clubhouse as usual but records writes in the plan
+type dryRunClubHouse struct {
+	AbstractClubHouse
+	plan *DryRunPlan
+}
+
+func (c *dryRunClubHouse) CreateStory(story *ClubHouseStory) error {
+	c.plan.mu.Lock()
+	defer c.plan.mu.Unlock()
+	planned := *story
+	c.plan.Story = &planned
+	return nil
+}
+
+func (c *dryRunClubHouse) AddCommentOnStory(storyID int, text string) error {
+	return c.CreateComment(storyID, &ClubHouseComment{Text: text})
+}
+
+func (c *dryRunClubHouse) CreateComment(storyID int, comment *ClubHouseComment) error {
+	c.plan.mu.Lock()
+	defer c.plan.mu.Unlock()
+	c.plan.Comments = append(c.plan.Comments, DryRunComment{storyID, comment.Text, comment.ExternalID})
+	return nil
+}
+
+func (c *dryRunClubHouse) UpdateStoryState(storyID int, stateID int) error {
+	var transition = DryRunTransition{StoryID: storyID, ToID: stateID}
+	var story = ClubHouseStory{}
+
+	if state, err := c.GetWorkflowStateByID(stateID); err == nil {
+		transition.To = state.Name
+	}
+	if err := c.GetStory(storyID, &story); err == nil && story.WorkflowStateID != 0 {
+		if state, err := c.GetWorkflowStateByID(story.WorkflowStateID); err == nil {
+			transition.From = state.Name
+		}
+	}
+
+	c.plan.mu.Lock()
+	defer c.plan.mu.Unlock()
+	c.plan.StateTransition = &transition
+	return nil
+}
+
+func (c *dryRunClubHouse) UpdateStoryOwners(storyID int, ownerIDs []string) error {
+	c.plan.mu.Lock()
+	defer c.plan.mu.Unlock()
+	c.plan.OwnerIDs = ownerIDs
+	return nil
+}
+
+func (c *dryRunClubHouse) UpdateStoryLabels(storyID int, labels []ClubHouseLabel) error {
+	c.plan.mu.Lock()
+	defer c.plan.mu.Unlock()
+	c.plan.Labels = labels
+	return nil
+}
+
+func (c *dryRunClubHouse) CreateEpic(epic *ClubHouseEpic) error {
+	c.plan.mu.Lock()
+	defer c.plan.mu.Unlock()
+	planned := *epic
+	c.plan.Epic = &planned
+	return nil
+}
@@ -0,0 +1,77 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZendeskClubhouseAdapter_DryRun(t *testing.T) {
+	tests := map[string]struct {
+		method         string
+		path           string
+		payload        string
+		header         string
+		env            string
+		wantStory      string
+		wantComments   int
+		wantTransition string
+	}{
+		"create story":               {http.MethodPost, "/tickets", `{"title": "unit test", "id": "NON_EXIST_ID", "url": "http://unittest.io", "organization": "InfuseAI" }`, "true", "", "[InfuseAI] unit test", 0, ""},
+		"comment and pending status": {http.MethodPut, "/", `{"id": "7777", "description": "Hello world", "status": "Pending" }`, "1", "", "", 1, "Created"},
+		"dry run by environment":     {http.MethodDelete, "/tickets/7777", "", "", "true", "", 0, "Created"},
+		"header cannot turn it off":  {http.MethodDelete, "/tickets/7777", "", "false", "true", "", 0, "Created"},
+	}
+
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	os.Setenv("AUTH_USER", "")
+	os.Setenv("AUTH_PASSWORD", "")
+	defer SetQueue(nil)
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var plan = DryRunPlan{}
+			auditLogPath := filepath.Join(t.TempDir(), "audit.jsonl")
+			t.Setenv("AUDIT_LOG_PATH", auditLogPath)
+			t.Setenv("DRY_RUN", tt.env)
+			// Dry runs are answered right away, even with a queue
+			queue := NewMemoryQueue()
+			SetQueue(queue)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.path, bytes.NewBuffer([]byte(tt.payload)))
+			if tt.header != "" {
+				r.Header.Set("X-Dry-Run", tt.header)
+			}
+			ZendeskClubhouseAdapter(w, r)
+
+			if s := w.Result().StatusCode; s != http.StatusOK {
+				t.Fatalf("got: %d, want: %d", s, http.StatusOK)
+			}
+			if err := json.NewDecoder(w.Result().Body).Decode(&plan); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantStory != "" && (plan.Story == nil || plan.Story.Name != tt.wantStory) {
+				t.Fatalf("got story %v, want %s", plan.Story, tt.wantStory)
+			}
+			if len(plan.Comments) != tt.wantComments {
+				t.Fatalf("got %d comments, want %d", len(plan.Comments), tt.wantComments)
+			}
+			if tt.wantTransition != "" && (plan.StateTransition == nil || plan.StateTransition.To != tt.wantTransition) {
+				t.Fatalf("got transition %v, want to %s", plan.StateTransition, tt.wantTransition)
+			}
+			if len(plan.Audit) == 0 {
+				t.Fatal("plan should list the audit entries")
+			}
+			if _, err := os.Stat(auditLogPath); !os.IsNotExist(err) {
+				t.Fatal("dry run should not write the audit log")
+			}
+			if queue.Len() != 0 {
+				t.Fatal("dry run should not be queued")
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package cloudfunction
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// epicRule attaches the stories of an organization, or of tickets with a tag
+// or field value, to an epic
+type epicRule struct {
+	kind  string
+	value string
+	epic  string
+}
+
+var epicRuleKinds = []string{"org", "tag", "field", "priority", "type", "group", "brand"}
+
+// epicRules parses EPIC_RULES, comma separated org:<organization>=<epic>,
+// tag:<tag>=<epic> and field:<custom field>:<value>=<epic> rules, or rules on
+// the priority, type, group or brand of the ticket, the first matching rule wins
+func epicRules() ([]epicRule, error) {
+	var rules []epicRule
+
+	for _, entry := range strings.Split(os.Getenv("EPIC_RULES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		match, epic, found := strings.Cut(entry, "=")
+		kind, value, _ := strings.Cut(match, ":")
+		if !found || !slices.Contains(epicRuleKinds, kind) || value == "" || epic == "" {
+			return nil, fmt.Errorf("invalid epic rule %q", entry)
+		}
+		rules = append(rules, epicRule{kind, strings.TrimSpace(value), strings.TrimSpace(epic)})
+	}
+	return rules, nil
+}
+
+func (r epicRule) matches(zendeskTicket *ZendeskTicket) bool {
+	return ticketMatches(zendeskTicket, r.kind, r.value)
+}
+
+// ticketMatches tells whether a ticket has the tag, the field:<name>:<value>
+// custom field value, or the value of another ticketValue kind
+func ticketMatches(zendeskTicket *ZendeskTicket, kind string, value string) bool {
+	switch kind {
+	case "tag":
+		return slices.ContainsFunc(zendeskTicket.Tags, func(tag string) bool {
+			return strings.EqualFold(value, tag)
+		})
+	case "field":
+		name, value, _ := strings.Cut(value, ":")
+		return value != "" && strings.EqualFold(value, zendeskTicket.CustomFields.Get(name))
+	}
+	return strings.EqualFold(value, ticketValue(zendeskTicket, kind))
+}
+
+// epicMu keeps concurrent workers from creating the same epic twice
+var epicMu sync.Mutex
+
+// storyEpic is the epic of the first matching rule, with EPIC_AUTO_CREATE
+// missing epics are created and tickets no rule matches get the epic named
+// after their organization. No epic is 0
+func storyEpic(ctx context.Context, clubhouse AbstractClubHouse, rules []epicRule, zendeskTicket *ZendeskTicket, teamID string) (int, error) {
+	var name string
+
+	for _, rule := range rules {
+		if rule.matches(zendeskTicket) {
+			name = rule.epic
+			break
+		}
+	}
+
+	autoCreate, _ := strconv.ParseBool(getEnv("EPIC_AUTO_CREATE", "false"))
+	if name == "" && autoCreate {
+		name = zendeskTicket.Organization
+	}
+	if name == "" {
+		return 0, nil
+	}
+
+	epicMu.Lock()
+	defer epicMu.Unlock()
+
+	epicID, err := clubhouse.GetEpicByName(name)
+	if err != os.ErrNotExist {
+		return epicID, err
+	}
+	if !autoCreate {
+		loggerFrom(ctx).Warn("Epic not found", "epic", name)
+		return 0, nil
+	}
+
+	var epic = ClubHouseEpic{Name: name}
+	if teamID != "" {
+		epic.GroupIDs = []string{teamID}
+	}
+	if milestone := getEnv("EPIC_MILESTONE", ""); milestone != "" {
+		epic.MilestoneID, err = clubhouse.GetMilestoneByName(milestone)
+		if err == os.ErrNotExist {
+			loggerFrom(ctx).Warn("Milestone not found", "milestone", milestone)
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	err = clubhouse.CreateEpic(&epic)
+	if err != nil {
+		return 0, err
+	}
+	loggerFrom(ctx).Info("Epic created", "epic", name, "epic_id", epic.ID)
+	audit(ctx, AuditEntry{Action: AuditEpicCreated, TicketID: zendeskTicket.ID, After: name})
+	return epic.ID, nil
+}
@@ -0,0 +1,80 @@
+package cloudfunction
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_epicRules(t *testing.T) {
+	tests := map[string]struct {
+		rules   string
+		want    []epicRule
+		wantErr bool
+	}{
+		"rules":        {"org:Acme=Acme Escalations, tag:vip=VIP Customers", []epicRule{{"org", "Acme", "Acme Escalations"}, {"tag", "vip", "VIP Customers"}}, false},
+		"no rules":     {"", nil, false},
+		"field rules":  {"field:Plan:enterprise=Enterprise,priority:urgent=Urgent", []epicRule{{"field", "Plan:enterprise", "Enterprise"}, {"priority", "urgent", "Urgent"}}, false},
+		"unknown kind": {"team:Support=Support", nil, true},
+		"no epic":      {"org:Acme", nil, true},
+	}
+
+	defer os.Unsetenv("EPIC_RULES")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			os.Setenv("EPIC_RULES", tt.rules)
+			got, err := epicRules()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("epicRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_storyEpic(t *testing.T) {
+	tests := map[string]struct {
+		autoCreate  string
+		milestone   string
+		ticket      ZendeskTicket
+		want        int
+		wantCreated []ClubHouseEpic
+	}{
+		"organization rule":    {"false", "", ZendeskTicket{Organization: "acme"}, 888, nil},
+		"tag rule":             {"false", "", ZendeskTicket{Organization: "Initech", Tags: []string{"urgent", "VIP"}}, 888, nil},
+		"no rule":              {"false", "", ZendeskTicket{Organization: "Initech"}, 0, nil},
+		"missing epic":         {"false", "", ZendeskTicket{Organization: "Globex"}, 0, nil},
+		"created epic":         {"true", "", ZendeskTicket{Organization: "Globex"}, 999, []ClubHouseEpic{{ID: 999, Name: "NON_EXIST_EPIC", GroupIDs: []string{"team-id"}}}},
+		"created in milestone": {"true", "Q3", ZendeskTicket{Organization: "NON_EXIST_EPIC"}, 999, []ClubHouseEpic{{ID: 999, Name: "NON_EXIST_EPIC", MilestoneID: 66, GroupIDs: []string{"team-id"}}}},
+		"organization epic":    {"true", "", ZendeskTicket{Organization: "Initech"}, 888, nil},
+		"field rule":           {"false", "", ZendeskTicket{Organization: "Initech", CustomFields: ZendeskCustomFields{"plan": "Enterprise"}}, 888, nil},
+		"priority rule":        {"false", "", ZendeskTicket{Organization: "Initech", Priority: "urgent"}, 888, nil},
+	}
+
+	err := setConfig(t, "EPIC_RULES", "org:Acme=Acme Escalations,tag:vip=VIP Customers,org:Globex=NON_EXIST_EPIC,field:Plan:enterprise=Enterprise,priority:urgent=Urgent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("EPIC_AUTO_CREATE")
+	defer os.Unsetenv("EPIC_MILESTONE")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			os.Setenv("EPIC_AUTO_CREATE", tt.autoCreate)
+			os.Setenv("EPIC_MILESTONE", tt.milestone)
+			clubhouse := &recordingClubHouse{}
+			got, err := storyEpic(context.Background(), clubhouse, loadedConfig.Load().EpicRules, &tt.ticket, "team-id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got: %d, want: %d", got, tt.want)
+			}
+			if !reflect.DeepEqual(clubhouse.epics, tt.wantCreated) {
+				t.Errorf("got created: %+v, want: %+v", clubhouse.epics, tt.wantCreated)
+			}
+		})
+	}
+}
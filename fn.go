@@ -2,22 +2,58 @@ package cloudfunction
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// ZendeskTicket is the payload of the webhooks, see payload.go for how it is decoded
 type ZendeskTicket struct {
 	Title        string `json:"title"`
 	Description  string `json:"description"`
 	Organization string `json:"organization"`
 	ID           string `json:"id"`
 	URL          string `json:"url"`
-	Status 	     string `json:"status"`
+	Status       string `json:"status"`
+	// PreviousStatus is the status before the change which triggered the webhook, if sent
+	PreviousStatus string              `json:"previous_status,omitempty"`
+	Comment        *ZendeskComment     `json:"comment,omitempty"`
+	Assignee       *ZendeskUser        `json:"assignee,omitempty"`
+	Requester      *ZendeskUser        `json:"requester,omitempty"`
+	Group          string              `json:"group,omitempty"`
+	Brand          string              `json:"brand,omitempty"`
+	Priority       string              `json:"priority,omitempty"`
+	Type           string              `json:"type,omitempty"`
+	Tags           ZendeskTags         `json:"tags,omitempty"`
+	CustomFields   ZendeskCustomFields `json:"custom_fields,omitempty"`
+	SLA            ZendeskSLATargets   `json:"sla,omitempty"`
+	CreatedAt      *time.Time          `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time          `json:"updated_at,omitempty"`
+}
+
+// ZendeskComment is the comment which triggered the webhook, Public is false for internal notes
+type ZendeskComment struct {
+	ID     string `json:"id"`
+	Author string `json:"author"`
+	Public bool   `json:"public"`
+	Body   string `json:"body"`
+}
+
+// LinkedStory is what Zendesk agents see about the story linked to a ticket
+type LinkedStory struct {
+	StoryID       int                 `json:"story_id"`
+	AppURL        string              `json:"app_url"`
+	WorkflowState string              `json:"workflow_state"`
+	Owners        []ClubHouseMember   `json:"owners"`
+	Iteration     *ClubHouseIteration `json:"iteration"`
 }
 
 func getEnv(key, fallback string) string {
@@ -27,150 +63,464 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-func createTicket(r *http.Request) error {
+// decodeTicket parses the Zendesk webhook payload, an empty body is treated as an empty ticket
+func decodeTicket(r *http.Request, zendeskTicket *ZendeskTicket) error {
+	err := json.NewDecoder(r.Body).Decode(zendeskTicket)
+	if err != nil && err != io.EOF {
+		loggerFrom(r.Context()).Warn("Zendesk ticket decode error", "error", err)
+		return os.ErrInvalid
+	}
+	return nil
+}
+
+// newClubHouse returns the client of CH_TOKEN, its calls are traced as part of ctx
+// and metadata lookups are cached. Writes only end up in the plan of dry runs
+func newClubHouse(ctx context.Context) (AbstractClubHouse, error) {
 	var token = os.Getenv("CH_TOKEN")
-	var zendeskTicket = ZendeskTicket{}
-	var clubhouseStory = ClubHouseStory{}
-	var currentIteration = ClubHouseIteration{}
-	var clubhouse = ClubHouseBuilder(token)
+	if token == "" {
+		return nil, os.ErrInvalid
+	}
+	var clubhouse AbstractClubHouse = &cachedClubHouse{&tracedClubHouse{ctx, ClubHouseBuilder(token)}, token}
+	if plan := dryRunPlanFrom(ctx); plan != nil {
+		clubhouse = &dryRunClubHouse{clubhouse, plan}
+	}
+	return clubhouse, nil
+}
 
-	// Parse request body
-	var decoder = json.NewDecoder(r.Body)
-	err := decoder.Decode(&zendeskTicket)
+// findStory looks the story up by the stored mapping first and falls back to
+// search by external ID, which also repairs missing or stale mappings
+func findStory(ctx context.Context, clubhouse AbstractClubHouse, zendeskTicket *ZendeskTicket, story *ClubHouseStory) error {
+	if zendeskTicket.ID == "" {
+		return os.ErrInvalid
+	}
+
+	storyID, err := Mappings().Get(zendeskTicket.ID)
+	if err == nil {
+		err = clubhouse.GetStory(storyID, story)
+		if err != os.ErrNotExist {
+			return err
+		}
+		// The story is gone, search for another one with the ticket's external ID
+		if plan := dryRunPlanFrom(ctx); plan != nil {
+			plan.dropMapping(storyID)
+		} else {
+			Mappings().Delete(zendeskTicket.ID)
+		}
+	} else if err != os.ErrNotExist {
+		loggerFrom(ctx).Error("Fail to read ticket mapping", "error", err)
+	}
+
+	externalID := fmt.Sprintf("zendesk-%s", zendeskTicket.ID)
+	err = clubhouse.GetStoryByExternalID(externalID, story)
 	if err != nil {
-		log.Fatalln("Zendesk ticket decode error")
 		return err
 	}
 
-	if token == "" ||
-		zendeskTicket.Title == "" ||
+	linkStory(ctx, zendeskTicket, story)
+	return nil
+}
+
+func linkStory(ctx context.Context, zendeskTicket *ZendeskTicket, story *ClubHouseStory) {
+	if dryRunPlanFrom(ctx) != nil {
+		return
+	}
+	err := Mappings().Put(zendeskTicket.ID, story.ID)
+	if err != nil {
+		loggerFrom(ctx).Error("Fail to store ticket mapping", "story_id", story.ID, "error", err)
+	}
+}
+
+func createTicket(ctx context.Context, zendeskTicket *ZendeskTicket) error {
+	_, err := createStory(ctx, zendeskTicket)
+	return err
+}
+
+// createStory creates the story of a ticket, unless it is already linked to one
+func createStory(ctx context.Context, zendeskTicket *ZendeskTicket) (created bool, err error) {
+	var clubhouseStory = ClubHouseStory{}
+
+	config, err := currentConfig()
+	if err != nil {
+		return false, err
+	}
+	clubhouse, err := newClubHouse(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if zendeskTicket.Title == "" ||
 		zendeskTicket.ID == "" ||
 		zendeskTicket.URL == "" {
-		return os.ErrInvalid
+		return false, os.ErrInvalid
+	}
+
+	// Zendesk may deliver the same ticket twice, never create a second story
+	var existingStory = ClubHouseStory{}
+	err = findStory(ctx, clubhouse, zendeskTicket, &existingStory)
+	if err == nil {
+		audit(ctx, AuditEntry{Action: AuditSkippedDuplicate, TicketID: zendeskTicket.ID, StoryID: existingStory.ID})
+		return false, nil
+	}
+	if err != os.ErrNotExist {
+		return false, err
 	}
 
 	// Prepare Clubhouse Story
 	clubhouseStoryType := getEnv("CLUBHOUSE_STORY_TYPE", "chore")
 	clubhouseProjectID, err := clubhouse.GetProjectByName(getEnv("CLUBHOUSE_PROJECT", "Support"))
-	clubhouseTeamID, err := clubhouse.GetTeamByName(getEnv("CLUBHOUSE_TEAM", "Support"))
+	clubhouseTeam := getEnv("CLUBHOUSE_TEAM", "Support")
+	clubhouseTeamID, err := clubhouse.GetTeamByName(clubhouseTeam)
 
 	clubhouseWorkflow := getEnv("CLUBHOUSE_WORKFLOW", "Support")
-	clubhouseCreatedState := getEnv("CLUBHOUSE_CREATED_STATE", "Created" )
+	clubhouseCreatedState := getEnv("CLUBHOUSE_CREATED_STATE", "Created")
 	clubhouseCreatedStateID, err := clubhouse.GetWorkflowStateByName(clubhouseWorkflow, clubhouseCreatedState)
 
 	if err != nil {
-		return err
+		return false, err
+	}
+	ZendeskToClubHouse(zendeskTicket, &clubhouseStory, clubhouseProjectID, clubhouseTeamID, clubhouseStoryType, clubhouseCreatedStateID)
+	clubhouseStory.Name, err = storyName(config.StoryName, zendeskTicket, clubhouseStory.Name)
+	if err != nil {
+		return false, err
 	}
-	ZendeskToClubHouse(&zendeskTicket, &clubhouseStory, clubhouseProjectID, clubhouseTeamID, clubhouseStoryType, clubhouseCreatedStateID)
 
-	// Get current Clubhouse iteration
-	err = clubhouse.CurrentIteration(&currentIteration)
+	redactions := RedactionCounts{}
+	clubhouseStory.Name = config.Redactor.Redact(clubhouseStory.Name, redactions)
+	clubhouseStory.Description = config.Redactor.Redact(clubhouseStory.Description, redactions)
+	storyPeople(ctx, clubhouse, zendeskTicket, clubhouseTeam, &clubhouseStory)
+
+	clubhouseStory.EpicID, err = storyEpic(ctx, clubhouse, config.EpicRules, zendeskTicket, clubhouseTeamID)
 	if err != nil {
-		log.Fatalln("Fail to get current iteration")
-		return err
+		return false, err
+	}
+
+	clubhouseStory.IterationID = storyIteration(ctx, clubhouse, config.IterationStrategy, clubhouseTeamID)
+
+	clubhouseStory.CustomFields, err = storyCustomFields(ctx, clubhouse, zendeskTicket, config.CustomFields)
+	if err != nil {
+		return false, err
 	}
-	clubhouseStory.IterationID = currentIteration.ID
+
+	clubhouseStory.Tasks = storyTasks(config.TaskTemplates, zendeskTicket, &clubhouseStory)
+
+	clubhouseStory.Deadline = storyDeadline(config.SLAOffsets, zendeskTicket, time.Now())
 
 	// Create Clubhouse Story
 	err = clubhouse.CreateStory(&clubhouseStory)
 	if err != nil {
-		log.Fatalln("Fail to create story")
+		loggerFrom(ctx).Error("Fail to create story", "error", err)
+		return false, err
+	}
+
+	linkStory(ctx, zendeskTicket, &clubhouseStory)
+	loggerFrom(ctx).Info("Story created", "story_id", clubhouseStory.ID)
+	audit(ctx, AuditEntry{Action: AuditStoryCreated, TicketID: zendeskTicket.ID, StoryID: clubhouseStory.ID, After: clubhouseCreatedState, Redactions: redactions})
+	return true, nil
+}
+
+func commentTicket(ctx context.Context, zendeskTicket *ZendeskTicket) error {
+	var story = ClubHouseStory{}
+
+	clubhouse, err := newClubHouse(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = findStory(ctx, clubhouse, zendeskTicket, &story)
+	if err != nil {
 		return err
 	}
+	ctx = withStory(ctx, story.ID)
+
+	return addComment(ctx, clubhouse, zendeskTicket, &story)
+}
+
+// ticketComment is the story comment of the ticket comment, or of the description
+// of legacy payloads, nil if there is nothing to post. Its external ID is the
+// Zendesk comment ID, legacy descriptions are keyed by their content
+func ticketComment(zendeskTicket *ZendeskTicket) *ClubHouseComment {
+	if comment := zendeskTicket.Comment; comment != nil {
+		if strings.TrimSpace(comment.Body) == "" {
+			return nil
+		}
+
+		author := comment.Author
+		if author == "" {
+			author = "Someone"
+		}
+		prefix := getEnv("COMMENT_PRIVATE_PREFIX", "[Internal note]")
+		if comment.Public {
+			prefix = getEnv("COMMENT_PUBLIC_PREFIX", "[Public reply]")
+		}
+		externalID := "zendesk-comment-" + comment.ID
+		if comment.ID == "" {
+			externalID = contentExternalID(zendeskTicket.ID, comment.Body)
+		}
+		return &ClubHouseComment{
+			Text:       fmt.Sprintf("%s **%s** on Zendesk:\n\n%s", prefix, author, comment.Body),
+			ExternalID: externalID,
+		}
+	}
 
+	if strings.TrimSpace(zendeskTicket.Description) == "" {
+		return nil
+	}
+	return &ClubHouseComment{
+		Text:       zendeskTicket.Description,
+		ExternalID: contentExternalID(zendeskTicket.ID, zendeskTicket.Description),
+	}
+}
+
+// commentForwarded tells whether COMMENT_VISIBILITY, public, private or both,
+// lets the comment through
+func commentForwarded(comment *ZendeskComment) bool {
+	switch strings.ToLower(getEnv("COMMENT_VISIBILITY", "both")) {
+	case "public":
+		return comment.Public
+	case "private":
+		return !comment.Public
+	}
+	return true
+}
+
+func contentExternalID(ticketID string, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("zendesk-%s-%x", ticketID, sum[:8])
+}
+
+// addComment posts the ticket comment unless the story already has it, so
+// re-deliveries and status-only updates never post a comment twice
+func addComment(ctx context.Context, clubhouse AbstractClubHouse, zendeskTicket *ZendeskTicket, story *ClubHouseStory) error {
+	var current = ClubHouseStory{}
+
+	if zendeskTicket.Comment != nil && !commentForwarded(zendeskTicket.Comment) {
+		audit(ctx, AuditEntry{Action: AuditCommentFiltered, TicketID: zendeskTicket.ID, StoryID: story.ID, Comment: "zendesk-comment-" + zendeskTicket.Comment.ID})
+		return nil
+	}
+
+	comment := ticketComment(zendeskTicket)
+	if comment == nil {
+		loggerFrom(ctx).Debug("Empty comment skipped")
+		return nil
+	}
+
+	config, err := currentConfig()
+	if err != nil {
+		return err
+	}
+	redactor := config.Redactor
+	// Public replies are written by and to customers
+	if zendeskTicket.Comment != nil && zendeskTicket.Comment.Public {
+		if redact, err := strconv.ParseBool(getEnv("COMMENT_REDACT_PUBLIC", "true")); err != nil || redact {
+			redactor = redactor.with("email", "phone")
+		}
+	}
+	redactions := RedactionCounts{}
+	comment.Text = redactor.Redact(comment.Text, redactions)
+
+	// Search results carry no comments, always look at the full story
+	err = clubhouse.GetStory(story.ID, &current)
+	if err != nil {
+		return err
+	}
+	for _, existing := range current.Comments {
+		if existing.ExternalID == comment.ExternalID {
+			audit(ctx, AuditEntry{Action: AuditSkippedDuplicate, TicketID: zendeskTicket.ID, StoryID: story.ID, Comment: comment.ExternalID})
+			return nil
+		}
+	}
+
+	err = clubhouse.CreateComment(story.ID, comment)
+	if err != nil {
+		return err
+	}
+	audit(ctx, AuditEntry{Action: AuditCommentAdded, TicketID: zendeskTicket.ID, StoryID: story.ID, Comment: comment.ExternalID, Redactions: redactions})
 	return nil
 }
 
-func updateTicket(r *http.Request) error {
-	var token = os.Getenv("CH_TOKEN")
-	var zendeskTicket = ZendeskTicket{}
+// statusStateName is the workflow state of a Zendesk status, empty for
+// statuses the story does not follow
+func statusStateName(status string) string {
+	switch strings.ToLower(status) {
+	case "pending":
+		return getEnv("CLUBHOUSE_PENDING_STATE", "Blocks")
+	case "solved", "closed":
+		return getEnv("CLUBHOUSE_COMPLETED_STATE", "Completed")
+	}
+	return ""
+}
+
+// syncTicketStatus moves the story to the workflow state matching the Zendesk status
+func syncTicketStatus(ctx context.Context, clubhouse AbstractClubHouse, zendeskTicket *ZendeskTicket, story *ClubHouseStory) error {
+	stateName := statusStateName(zendeskTicket.Status)
+	if stateName == "" {
+		return nil
+	}
+
+	stateID, err := clubhouse.GetWorkflowStateByName(getEnv("CLUBHOUSE_WORKFLOW", "Dev"), stateName)
+	if err != nil {
+		return err
+	}
+
+	if stateID == story.WorkflowStateID {
+		return nil
+	}
+
+	before := ""
+	if story.WorkflowStateID != 0 {
+		state, err := clubhouse.GetWorkflowStateByID(story.WorkflowStateID)
+		if err == nil {
+			before = state.Name
+		}
+	}
+
+	err = clubhouse.UpdateStoryState(story.ID, stateID)
+	if err != nil {
+		return err
+	}
+	audit(ctx, AuditEntry{Action: AuditStateChanged, TicketID: zendeskTicket.ID, StoryID: story.ID, Before: before, After: stateName})
+	return nil
+}
+
+func updateTicketStatus(ctx context.Context, zendeskTicket *ZendeskTicket) error {
 	var story = ClubHouseStory{}
-	var clubhouse = ClubHouseBuilder(token)
 
-	// Parse request body
-	var decoder = json.NewDecoder(r.Body)
-	err := decoder.Decode(&zendeskTicket)
+	clubhouse, err := newClubHouse(ctx)
 	if err != nil {
-		log.Fatalln("Zendesk ticket decode error")
 		return err
 	}
 
-	if token == "" ||
-		zendeskTicket.ID == "" {
-		return os.ErrInvalid
+	err = findStory(ctx, clubhouse, zendeskTicket, &story)
+	if err != nil {
+		return err
 	}
+	ctx = withStory(ctx, story.ID)
 
-	externalID := fmt.Sprintf("zendesk-%s", zendeskTicket.ID)
-	err = clubhouse.GetStoryByExternalID(externalID, &story)
+	err = syncOwners(ctx, clubhouse, zendeskTicket, &story)
 	if err != nil {
 		return err
 	}
 
-	err = clubhouse.AddCommentOnStory(story.ID, zendeskTicket.Description)
+	_, err = reopenStory(ctx, clubhouse, zendeskTicket, &story)
 	if err != nil {
 		return err
 	}
 
-	if zendeskTicket.Status == "Pending" {
-		workflow := getEnv("CLUBHOUSE_WORKFLOW", "Dev")
-		pendingState := getEnv("CLUBHOUSE_PENDING_STATE", "Blocks" )
-		pendingStateID, err := clubhouse.GetWorkflowStateByName(workflow, pendingState)
-		if err != nil {
-			return err
-		}
+	return syncTicketStatus(ctx, clubhouse, zendeskTicket, &story)
+}
 
-		if pendingStateID != story.WorkflowStateID {
-			err = clubhouse.UpdateStoryState(story.ID, pendingStateID)
-			if err != nil {
-				return err
-			}
-		}
+// updateTicket is the legacy update, it comments on the story and only follows
+// the Pending status, or reopens the story of a reopened ticket
+func updateTicket(ctx context.Context, zendeskTicket *ZendeskTicket) error {
+	var story = ClubHouseStory{}
+
+	clubhouse, err := newClubHouse(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = findStory(ctx, clubhouse, zendeskTicket, &story)
+	if err != nil {
+		return err
+	}
+	ctx = withStory(ctx, story.ID)
+
+	err = addComment(ctx, clubhouse, zendeskTicket, &story)
+	if err != nil {
+		return err
+	}
+
+	err = syncOwners(ctx, clubhouse, zendeskTicket, &story)
+	if err != nil {
+		return err
+	}
+
+	_, err = reopenStory(ctx, clubhouse, zendeskTicket, &story)
+	if err != nil {
+		return err
+	}
+
+	if zendeskTicket.Status == "pending" {
+		return syncTicketStatus(ctx, clubhouse, zendeskTicket, &story)
 	}
 
 	return nil
 }
 
-func closeTicket(r *http.Request) error {
-	var token = os.Getenv("CH_TOKEN")
-	var zendeskTicket = ZendeskTicket{}
+func closeTicket(ctx context.Context, zendeskTicket *ZendeskTicket) error {
 	var story = ClubHouseStory{}
-	var clubhouse = ClubHouseBuilder(token)
 
-	// Parse request body
-	var decoder = json.NewDecoder(r.Body)
-	err := decoder.Decode(&zendeskTicket)
+	clubhouse, err := newClubHouse(ctx)
 	if err != nil {
-		log.Fatalln("Zendesk ticket decode error")
 		return err
 	}
 
-	if token == "" ||
-		zendeskTicket.ID == "" {
-		return os.ErrInvalid
+	err = findStory(ctx, clubhouse, zendeskTicket, &story)
+	if err != nil {
+		return err
 	}
+	ctx = withStory(ctx, story.ID)
 
-	externalID := fmt.Sprintf("zendesk-%s", zendeskTicket.ID)
-	err = clubhouse.GetStoryByExternalID(externalID, &story)
+	zendeskTicket.Status = "Closed"
+	return syncTicketStatus(ctx, clubhouse, zendeskTicket, &story)
+}
+
+func getLinkedStory(ctx context.Context, zendeskTicket *ZendeskTicket, linkedStory *LinkedStory) error {
+	var story = ClubHouseStory{}
+
+	clubhouse, err := newClubHouse(ctx)
 	if err != nil {
 		return err
 	}
 
-	workflow := getEnv("CLUBHOUSE_WORKFLOW", "Dev")
-	completedState := getEnv("CLUBHOUSE_COMPLETED_STATE", "Completed")
-	completedStateID, err := clubhouse.GetWorkflowStateByName(workflow, completedState)
+	err = findStory(ctx, clubhouse, zendeskTicket, &story)
 	if err != nil {
 		return err
 	}
+	return describeStory(withStory(ctx, story.ID), clubhouse, &story, linkedStory)
+}
 
-	if completedStateID == story.WorkflowStateID {
-		return nil
+// describeStory describes the story for the sidebar app. The workflow state,
+// the owners and the iteration are extras, they are left out when their lookup
+// fails
+func describeStory(ctx context.Context, clubhouse AbstractClubHouse, story *ClubHouseStory, linkedStory *LinkedStory) error {
+	linkedStory.StoryID = story.ID
+	linkedStory.AppURL = story.AppURL
+	linkedStory.Owners = []ClubHouseMember{}
+
+	if story.WorkflowStateID != 0 {
+		state, err := clubhouse.GetWorkflowStateByID(story.WorkflowStateID)
+		if err != nil {
+			loggerFrom(ctx).Warn("Fail to get the workflow state of the linked story", "workflow_state_id", story.WorkflowStateID, "error", err)
+		} else {
+			linkedStory.WorkflowState = state.Name
+		}
 	}
 
-	return clubhouse.UpdateStoryState(story.ID, completedStateID)
+	for _, ownerID := range story.OwnerIDs {
+		var owner = ClubHouseMember{}
+		err := clubhouse.GetMember(ownerID, &owner)
+		if err != nil {
+			loggerFrom(ctx).Warn("Fail to get an owner of the linked story", "owner_id", ownerID, "error", err)
+			continue
+		}
+		linkedStory.Owners = append(linkedStory.Owners, owner)
+	}
+
+	if story.IterationID != 0 {
+		var iteration = ClubHouseIteration{}
+		err := clubhouse.GetIteration(story.IterationID, &iteration)
+		if err != nil {
+			loggerFrom(ctx).Warn("Fail to get the iteration of the linked story", "iteration_id", story.IterationID, "error", err)
+		} else {
+			linkedStory.Iteration = &iteration
+		}
+	}
+
+	return nil
 }
 
 func verifyBasicAuth(w http.ResponseWriter, r *http.Request, user string, password string) bool {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	basicAuthPrefix := "Basic "
 	auth := r.Header.Get("Authorization")
 
@@ -194,40 +544,53 @@ func verifyBasicAuth(w http.ResponseWriter, r *http.Request, user string, passwo
 	return false
 }
 
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var logger = loggerFrom(r.Context())
+
+	if err == os.ErrInvalid {
+		w.WriteHeader(http.StatusBadRequest)
+		logger.Warn("Invalid request", "error", err)
+	} else if err == os.ErrNotExist {
+		w.WriteHeader(http.StatusNotFound)
+		logger.Warn("Not found", "error", err)
+	} else if err == ErrStoryConflict {
+		w.WriteHeader(http.StatusConflict)
+		logger.Warn("Conflicting stories", "error", err)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+		logger.Error("Request failed", "error", err)
+	}
+}
+
 func ZendeskClubhouseAdapter(w http.ResponseWriter, r *http.Request) {
 	var user = os.Getenv("AUTH_USER")
 	var password = os.Getenv("AUTH_PASSWORD")
-	var method = r.Method
-	var err error
+
+	InitTracing(r.Context(), false)
+	InitMetrics(context.Background(), true)
+	ctx, span := startRequestSpan(r)
+	recorder := &statusRecorder{w, http.StatusOK}
+	defer func() { endRequestSpan(span, recorder.status) }()
+
+	ctx, id := withRequestLogger(r.WithContext(ctx))
+	if spanContext := span.SpanContext(); spanContext.IsValid() {
+		ctx = withLogger(ctx, loggerFrom(ctx).With("trace_id", spanContext.TraceID().String()))
+	}
+	w.Header().Set("X-Request-ID", id)
 
 	// Check http authorization
 	if verifyBasicAuth(w, r, user, password) == false {
-		w.WriteHeader(http.StatusUnauthorized)
+		loggerFrom(ctx).Warn("Unauthorized request", "method", r.Method, "path", r.URL.Path)
+		recorder.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	if method == http.MethodPost {
-		err = createTicket(r)
-	} else if method == http.MethodPut {
-		err = updateTicket(r)
-	} else if method == http.MethodDelete {
-		err = closeTicket(r)
-	} else {
-		// Unsupported method
-		w.WriteHeader(http.StatusTeapot)
+	// Functions have no startup, the first request loads the configuration
+	if _, err := currentConfig(); err != nil {
+		loggerFrom(ctx).Error("Invalid configuration", "error", err)
+		recorder.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if err != nil {
-		if err == os.ErrInvalid {
-			w.WriteHeader(http.StatusBadRequest)
-		} else if err == os.ErrNotExist {
-			w.WriteHeader(http.StatusNotFound)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-		log.Printf("[Error] %s", err)
-		return
-	}
-	w.WriteHeader(http.StatusCreated)
+	router.ServeHTTP(recorder, r.WithContext(ctx))
 }
@@ -2,14 +2,31 @@ package cloudfunction
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
+func TestMain(m *testing.M) {
+	// Keep dead letters and audit entries of the tests out of the real defaults
+	dir, err := os.MkdirTemp("", "zendesk-clubhouse-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("DEAD_LETTER_DIR", filepath.Join(dir, "dead-letters"))
+	os.Setenv("AUDIT_LOG_PATH", filepath.Join(dir, "audit.jsonl"))
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestZendeskClubhouseAdapter(t *testing.T) {
 	type args struct {
 		w http.ResponseWriter
@@ -63,3 +80,194 @@ func TestZendeskClubhouseAdapter(t *testing.T) {
 		})
 	}
 }
+
+func Test_describeStory(t *testing.T) {
+	iteration := ClubHouseIteration{ID: 4, Name: "Sprint 4", Status: "started"}
+	jane := ClubHouseMember{ID: "jane", Profile: ClubHouseMemberProfile{Name: "Jane Doe"}}
+	tests := map[string]struct {
+		story ClubHouseStory
+		want  LinkedStory
+	}{
+		"linked": {ClubHouseStory{ID: 777, AppURL: "https://app.shortcut.com/org/story/777", WorkflowStateID: 500000011, IterationID: 4},
+			LinkedStory{StoryID: 777, AppURL: "https://app.shortcut.com/org/story/777", WorkflowState: "Created", Owners: []ClubHouseMember{}, Iteration: &iteration}},
+		"failing workflow state": {ClubHouseStory{ID: 777, WorkflowStateID: 13, IterationID: 4},
+			LinkedStory{StoryID: 777, Owners: []ClubHouseMember{}, Iteration: &iteration}},
+		"failing iteration": {ClubHouseStory{ID: 777, WorkflowStateID: 500000011, IterationID: 13},
+			LinkedStory{StoryID: 777, WorkflowState: "Created", Owners: []ClubHouseMember{}}},
+		"deleted owner": {ClubHouseStory{ID: 777, OwnerIDs: []string{"jane", "deleted"}},
+			LinkedStory{StoryID: 777, Owners: []ClubHouseMember{jane}}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got = LinkedStory{}
+			clubhouse := &recordingClubHouse{iterations: []ClubHouseIteration{iteration}, members: map[string]ClubHouseMember{"jane": jane}, failing: 13}
+			err := describeStory(context.Background(), clubhouse, &tt.story, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got: %+v, want: %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The mock links every ticket but NON_EXIST_ID and 9999 to story 777
+func TestZendeskClubhouseAdapter_CreateStory(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		path       string
+		ticketID   string
+		wantAction string
+	}{
+		"create story":                {http.MethodPost, "/tickets", "9999", AuditStoryCreated},
+		"skip duplicate":              {http.MethodPost, "/tickets", "7777", AuditSkippedDuplicate},
+		"legacy create story":         {http.MethodPost, "/", "9999", AuditStoryCreated},
+		"legacy skip duplicate":       {http.MethodPost, "/", "7777", AuditSkippedDuplicate},
+		"create story on other route": {http.MethodPost, "/ZendeskClubhouseAdapter", "9999", AuditStoryCreated},
+	}
+
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	os.Setenv("AUTH_USER", "")
+	os.Setenv("AUTH_PASSWORD", "")
+	defer SetMappingStore(NewMemoryMappingStore())
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("AUDIT_LOG_PATH", filepath.Join(t.TempDir(), "audit.jsonl"))
+			SetMappingStore(NewMemoryMappingStore())
+			w := httptest.NewRecorder()
+			payload := fmt.Sprintf(`{"title": "unit test", "id": %q, "url": "http://unittest.io" }`, tt.ticketID)
+
+			ZendeskClubhouseAdapter(w, httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(payload)))
+
+			if s := w.Result().StatusCode; s != http.StatusCreated {
+				t.Fatalf("got: %d, want: %d", s, http.StatusCreated)
+			}
+			// Only a story returned by CreateStory is audited as created
+			entries, err := AuditLog().Query(tt.ticketID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Action != tt.wantAction || entries[0].StoryID != 777 {
+				t.Errorf("got: %+v, want one %s entry of story 777", entries, tt.wantAction)
+			}
+			if storyID, err := Mappings().Get(tt.ticketID); err != nil || storyID != 777 {
+				t.Errorf("got mapping: %d %v, want: 777", storyID, err)
+			}
+		})
+	}
+}
+
+func Test_ticketComment(t *testing.T) {
+	tests := map[string]struct {
+		ticket ZendeskTicket
+		want   *ClubHouseComment
+	}{
+		"public reply": {ZendeskTicket{ID: "7777", Comment: &ZendeskComment{"101", "Jane Doe", true, "It works again, call me at +1 415 555 0100"}},
+			&ClubHouseComment{Text: "[Public reply] **Jane Doe** on Zendesk:\n\nIt works again, call me at +1 415 555 0100", ExternalID: "zendesk-comment-101"}},
+		"internal note": {ZendeskTicket{ID: "7777", Comment: &ZendeskComment{"102", "John Doe", false, "Escalated, customer is jane@example.com"}},
+			&ClubHouseComment{Text: "[Internal note] **John Doe** on Zendesk:\n\nEscalated, customer is jane@example.com", ExternalID: "zendesk-comment-102"}},
+		"empty comment":            {ZendeskTicket{ID: "7777", Description: "Hello world", Comment: &ZendeskComment{"103", "Jane Doe", true, " \n"}}, nil},
+		"legacy description":       {ZendeskTicket{ID: "7777", Description: "Hello world"}, &ClubHouseComment{Text: "Hello world", ExternalID: contentExternalID("7777", "Hello world")}},
+		"empty legacy description": {ZendeskTicket{ID: "7777", Status: "Pending"}, nil},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := ticketComment(&tt.ticket)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got: %+v, want: %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// commentedStory already has the comment 101 of the ticket
+var commentedStory = ClubHouseStory{Comments: []ClubHouseComment{{ID: 1, Text: "Hello", ExternalID: "zendesk-comment-101"}}}
+
+func Test_addComment(t *testing.T) {
+	tests := map[string]struct {
+		visibility  string
+		comment     *ZendeskComment
+		wantCreated int
+	}{
+		"new comment":                 {"both", &ZendeskComment{"102", "Jane Doe", true, "Hello again"}, 1},
+		"redelivered":                 {"both", &ZendeskComment{"101", "Jane Doe", true, "Hello"}, 0},
+		"status-only event":           {"both", &ZendeskComment{"", "", false, ""}, 0},
+		"public reply, public only":   {"public", &ZendeskComment{"102", "Jane Doe", true, "Hello again"}, 1},
+		"internal note, public only":  {"public", &ZendeskComment{"102", "John Doe", false, "Escalated"}, 0},
+		"public reply, private only":  {"private", &ZendeskComment{"102", "Jane Doe", true, "Hello again"}, 0},
+		"internal note, private only": {"private", &ZendeskComment{"102", "John Doe", false, "Escalated"}, 1},
+	}
+
+	defer os.Unsetenv("COMMENT_VISIBILITY")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			os.Setenv("COMMENT_VISIBILITY", tt.visibility)
+			clubhouse := &recordingClubHouse{story: commentedStory}
+			ticket := ZendeskTicket{ID: "7777", Comment: tt.comment}
+			err := addComment(context.Background(), clubhouse, &ticket, &ClubHouseStory{ID: 777})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(clubhouse.comments) != tt.wantCreated {
+				t.Errorf("got %d created comments, want %d", len(clubhouse.comments), tt.wantCreated)
+			}
+		})
+	}
+}
+
+func Test_addComment_redaction(t *testing.T) {
+	tests := map[string]struct {
+		redactPublic string
+		comment      *ZendeskComment
+		want         string
+	}{
+		"public reply":              {"", &ZendeskComment{"102", "Jane Doe", true, "Mail jane@example.com"}, "[Public reply] **Jane Doe** on Zendesk:\n\nMail [email redacted]"},
+		"internal note":             {"", &ZendeskComment{"102", "John Doe", false, "Mail jane@example.com"}, "[Internal note] **John Doe** on Zendesk:\n\nMail jane@example.com"},
+		"public reply not redacted": {"false", &ZendeskComment{"102", "Jane Doe", true, "Mail jane@example.com"}, "[Public reply] **Jane Doe** on Zendesk:\n\nMail jane@example.com"},
+	}
+
+	// Only the public reply rule redacts
+	if err := setConfig(t, "REDACT_DETECTORS", "none"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("COMMENT_REDACT_PUBLIC")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			os.Setenv("COMMENT_REDACT_PUBLIC", tt.redactPublic)
+			clubhouse := &recordingClubHouse{story: commentedStory}
+			ticket := ZendeskTicket{ID: "7777", Comment: tt.comment}
+			err := addComment(context.Background(), clubhouse, &ticket, &ClubHouseStory{ID: 777})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(clubhouse.comments) != 1 || clubhouse.comments[0].Text != tt.want {
+				t.Errorf("got: %+v, want: %q", clubhouse.comments, tt.want)
+			}
+		})
+	}
+}
+
+func Test_writeError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"invalid", os.ErrInvalid, http.StatusBadRequest},
+		{"not found", os.ErrNotExist, http.StatusNotFound},
+		{"conflict", ErrStoryConflict, http.StatusConflict},
+		{"failure", fmt.Errorf("500 Internal Server Error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, httptest.NewRequest(http.MethodPost, "/", nil), tt.err)
+			if w.Code != tt.want {
+				t.Errorf("writeError() status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+}
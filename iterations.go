@@ -0,0 +1,127 @@
+package cloudfunction
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	IterationNone           = "none"
+	IterationCurrent        = "current"
+	IterationCurrentByDate  = "current-by-date"
+	IterationCurrentForTeam = "current-for-team"
+	IterationNextUpcoming   = "next-upcoming"
+)
+
+// iterationDate parses the date of an iteration, which may come with a time
+func iterationDate(date string) (time.Time, bool) {
+	if len(date) < len("2006-01-02") {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("2006-01-02", date[:len("2006-01-02")])
+	return t, err == nil
+}
+
+// runningIteration is the iteration running on the day, the one started last
+// if they overlap, only iterations of the team unless teamID is empty
+func runningIteration(iterations []ClubHouseIteration, teamID string, day time.Time) (ClubHouseIteration, bool) {
+	var running ClubHouseIteration
+	var runningStart time.Time
+
+	for _, iteration := range iterations {
+		if teamID != "" && !slices.Contains(iteration.GroupIDs, teamID) {
+			continue
+		}
+		start, ok := iterationDate(iteration.StartDate)
+		end, ok2 := iterationDate(iteration.EndDate)
+		if !ok || !ok2 || day.Before(start) || day.After(end) {
+			continue
+		}
+		if running.ID == 0 || start.After(runningStart) {
+			running, runningStart = iteration, start
+		}
+	}
+	return running, running.ID != 0
+}
+
+// upcomingIteration is the iteration starting first after the day
+func upcomingIteration(iterations []ClubHouseIteration, day time.Time) (ClubHouseIteration, bool) {
+	var upcoming ClubHouseIteration
+	var upcomingStart time.Time
+
+	for _, iteration := range iterations {
+		start, ok := iterationDate(iteration.StartDate)
+		if !ok || !start.After(day) {
+			continue
+		}
+		if upcoming.ID == 0 || start.Before(upcomingStart) {
+			upcoming, upcomingStart = iteration, start
+		}
+	}
+	return upcoming, upcoming.ID != 0
+}
+
+// selectIteration picks the iteration of a new story by strategy: current, the
+// started iteration with the highest ID, current-by-date, current-for-team,
+// the one of the team running today, or next-upcoming. No iteration is 0
+func selectIteration(clubhouse AbstractClubHouse, strategy string, teamID string, now time.Time) (int, error) {
+	var iterations []ClubHouseIteration
+	var iteration ClubHouseIteration
+	var found bool
+
+	switch strategy {
+	case IterationNone:
+		return 0, nil
+	case IterationCurrent:
+		err := clubhouse.CurrentIteration(&iteration)
+		return iteration.ID, err
+	case IterationCurrentByDate, IterationCurrentForTeam, IterationNextUpcoming:
+	default:
+		return 0, os.ErrInvalid
+	}
+
+	err := clubhouse.ListIterations(&iterations)
+	if err != nil {
+		return 0, err
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch strategy {
+	case IterationCurrentByDate:
+		iteration, found = runningIteration(iterations, "", today)
+	case IterationCurrentForTeam:
+		iteration, found = runningIteration(iterations, teamID, today)
+	case IterationNextUpcoming:
+		iteration, found = upcomingIteration(iterations, today)
+	}
+	if !found {
+		return 0, os.ErrNotExist
+	}
+	return iteration.ID, nil
+}
+
+// iterationStrategy is CLUBHOUSE_ITERATION_STRATEGY, one of the Iteration
+// strategies
+func iterationStrategy() (string, error) {
+	strategy := strings.ToLower(strings.TrimSpace(getEnv("CLUBHOUSE_ITERATION_STRATEGY", IterationCurrent)))
+	switch strategy {
+	case IterationNone, IterationCurrent, IterationCurrentByDate, IterationCurrentForTeam, IterationNextUpcoming:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown CLUBHOUSE_ITERATION_STRATEGY %q", strategy)
+}
+
+// storyIteration is the iteration the strategy picks, a ticket is never
+// rejected for lack of an iteration, the story is left without one
+func storyIteration(ctx context.Context, clubhouse AbstractClubHouse, strategy string, teamID string) int {
+	iterationID, err := selectIteration(clubhouse, strategy, teamID, time.Now())
+	if err != nil {
+		loggerFrom(ctx).Warn("No iteration for the story", "strategy", strategy, "error", err)
+		return 0
+	}
+	return iterationID
+}
@@ -0,0 +1,58 @@
+package cloudfunction
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// iterationsClubHouse has three support iterations and one of another team
+var iterationsClubHouse = recordingClubHouse{
+	iterations: []ClubHouseIteration{
+		{ID: 1, Status: "done", StartDate: "2024-04-29", EndDate: "2024-05-12", GroupIDs: []string{"team-id"}},
+		{ID: 2, Status: "started", StartDate: "2024-05-13", EndDate: "2024-05-26", GroupIDs: []string{"team-id"}},
+		{ID: 3, Status: "unstarted", StartDate: "2024-05-27", EndDate: "2024-06-09", GroupIDs: []string{"team-id"}},
+		{ID: 4, Status: "started", StartDate: "2024-05-20T00:00:00Z", EndDate: "2024-05-31T00:00:00Z", GroupIDs: []string{"other-team-id"}},
+	},
+	current: 4,
+}
+
+func Test_selectIteration(t *testing.T) {
+	tests := map[string]struct {
+		strategy string
+		now      string
+		want     int
+		wantErr  error
+	}{
+		"none":                      {IterationNone, "2024-05-21", 0, nil},
+		"current":                   {IterationCurrent, "2024-05-21", 4, nil},
+		"current by date":           {IterationCurrentByDate, "2024-05-21", 4, nil},
+		"current by date, last day": {IterationCurrentByDate, "2024-05-12", 1, nil},
+		"current for team":          {IterationCurrentForTeam, "2024-05-21", 2, nil},
+		"current for team, none":    {IterationCurrentForTeam, "2024-07-01", 0, os.ErrNotExist},
+		"next upcoming":             {IterationNextUpcoming, "2024-05-21", 3, nil},
+		"next upcoming, none":       {IterationNextUpcoming, "2024-06-01", 0, os.ErrNotExist},
+		"unknown strategy":          {"latest", "2024-05-21", 0, os.ErrInvalid},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			now, _ := time.Parse("2006-01-02", tt.now)
+			got, err := selectIteration(&iterationsClubHouse, tt.strategy, "team-id", now.Add(15*time.Hour))
+			if err != tt.wantErr {
+				t.Fatalf("selectIteration() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got: %d, want: %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_storyIteration_fallback(t *testing.T) {
+	// The mock has no iterations at all
+	if got := storyIteration(context.Background(), &MockClubHouse{}, IterationNextUpcoming, "team-id"); got != 0 {
+		t.Errorf("got: %d, want no iteration", got)
+	}
+}
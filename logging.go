@@ -0,0 +1,111 @@
+package cloudfunction
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func init() {
+	slog.SetDefault(newLogger(os.Stderr, getEnv("LOG_LEVEL", "info")))
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// newLogger writes JSON lines which Cloud Logging understands: the level is
+// reported as severity and the text as message
+func newLogger(w io.Writer, level string) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: parseLevel(level),
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.LevelKey:
+				a.Key = "severity"
+				if level, ok := a.Value.Any().(slog.Level); ok && level == slog.LevelWarn {
+					a.Value = slog.StringValue("WARNING")
+				}
+			case slog.MessageKey:
+				a.Key = "message"
+			}
+			return a
+		},
+	}))
+}
+
+type loggerKey struct{}
+
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the request-scoped logger, carrying the correlation ID
+// and whatever ticket or story the request is about
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func newCorrelationID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// withRequestLogger scopes the logger to a correlation ID, reusing the ID of
+// the caller or of the Cloud Functions trace, which is also linked in Cloud
+// Logging when the project is known
+func withRequestLogger(r *http.Request) (context.Context, string) {
+	var logger = slog.Default()
+	var id = r.Header.Get("X-Request-ID")
+
+	if trace := r.Header.Get("X-Cloud-Trace-Context"); trace != "" {
+		traceID := strings.SplitN(trace, "/", 2)[0]
+		if id == "" {
+			id = traceID
+		}
+		if project := os.Getenv("GOOGLE_CLOUD_PROJECT"); project != "" {
+			logger = logger.With("logging.googleapis.com/trace", fmt.Sprintf("projects/%s/traces/%s", project, traceID))
+		}
+	}
+	if id == "" {
+		id = newCorrelationID()
+	}
+	return withLogger(r.Context(), logger.With("correlation_id", id)), id
+}
+
+// withCorrelation restores the correlation ID of a queued event
+func withCorrelation(ctx context.Context, id string) context.Context {
+	if _, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok || id == "" {
+		return ctx
+	}
+	return withLogger(ctx, slog.Default().With("correlation_id", id))
+}
+
+func withTicket(ctx context.Context, ticketID string) context.Context {
+	return withLogger(ctx, loggerFrom(ctx).With("ticket_id", ticketID))
+}
+
+func withStory(ctx context.Context, storyID int) context.Context {
+	return withLogger(ctx, loggerFrom(ctx).With("story_id", storyID))
+}
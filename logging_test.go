@@ -0,0 +1,76 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func Test_newLogger(t *testing.T) {
+	tests := map[string]struct {
+		level        string
+		log          func(*bytes.Buffer)
+		wantSeverity string
+	}{
+		"info":             {"info", func(b *bytes.Buffer) { newLogger(b, "info").Info("hello") }, "INFO"},
+		"warning":          {"info", func(b *bytes.Buffer) { newLogger(b, "info").Warn("hello") }, "WARNING"},
+		"error":            {"warn", func(b *bytes.Buffer) { newLogger(b, "warn").Error("hello") }, "ERROR"},
+		"debug suppressed": {"info", func(b *bytes.Buffer) { newLogger(b, "info").Debug("hello") }, ""},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			var line map[string]interface{}
+			tt.log(&buffer)
+
+			if tt.wantSeverity == "" {
+				if buffer.Len() != 0 {
+					t.Fatalf("got: %s, want no output", buffer.String())
+				}
+				return
+			}
+			if err := json.Unmarshal(buffer.Bytes(), &line); err != nil {
+				t.Fatal(err)
+			}
+			if line["severity"] != tt.wantSeverity || line["message"] != "hello" {
+				t.Fatalf("got: %v, want severity %s and message hello", line, tt.wantSeverity)
+			}
+		})
+	}
+}
+
+func TestZendeskClubhouseAdapter_CorrelationID(t *testing.T) {
+	tests := map[string]struct {
+		header string
+		value  string
+		wantID string
+	}{
+		"caller request ID":    {"X-Request-ID", "abc", "abc"},
+		"cloud trace context":  {"X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1", "105445aa7843bc8bf206b12000100000"},
+		"generated request ID": {"", "", ""},
+	}
+
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	os.Setenv("AUTH_USER", "")
+	os.Setenv("AUTH_PASSWORD", "")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/tickets/7777", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+
+			ZendeskClubhouseAdapter(w, r)
+
+			id := w.Result().Header.Get("X-Request-ID")
+			if id == "" || (tt.wantID != "" && id != tt.wantID) {
+				t.Fatalf("got: %q, want: %q", id, tt.wantID)
+			}
+		})
+	}
+}
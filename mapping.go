@@ -0,0 +1,145 @@
+package cloudfunction
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// MappingStore links Zendesk ticket IDs to Clubhouse story IDs, so the story
+// can be found without searching by external ID
+type MappingStore interface {
+	// Get returns os.ErrNotExist for tickets without a mapping
+	Get(string) (int, error)
+	Put(string, int) error
+	Delete(string) error
+}
+
+var (
+	mappingStore     MappingStore
+	mappingStoreOnce sync.Once
+)
+
+func MappingStoreBuilder(kind string, path string) (MappingStore, error) {
+	switch kind {
+	case "", "memory":
+		return NewMemoryMappingStore(), nil
+	case "bolt":
+		return NewBoltMappingStore(path)
+	}
+	return nil, fmt.Errorf("unknown mapping store %q", kind)
+}
+
+// Mappings returns the store configured by MAPPING_STORE and MAPPING_STORE_PATH,
+// falling back to memory when it can not be opened
+func Mappings() MappingStore {
+	mappingStoreOnce.Do(func() {
+		if mappingStore != nil {
+			return
+		}
+		store, err := MappingStoreBuilder(os.Getenv("MAPPING_STORE"), getEnv("MAPPING_STORE_PATH", "mappings.db"))
+		if err != nil {
+			slog.Error("Fail to open mapping store, keeping mappings in memory", "error", err)
+			store = NewMemoryMappingStore()
+		}
+		mappingStore = store
+	})
+	return mappingStore
+}
+
+// SetMappingStore replaces the store configured by the environment
+func SetMappingStore(store MappingStore) {
+	mappingStoreOnce.Do(func() {})
+	mappingStore = store
+}
+
+type MemoryMappingStore struct {
+	mu       sync.RWMutex
+	mappings map[string]int
+}
+
+func NewMemoryMappingStore() *MemoryMappingStore {
+	return &MemoryMappingStore{mappings: map[string]int{}}
+}
+
+func (s *MemoryMappingStore) Get(ticketID string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	storyID, ok := s.mappings[ticketID]
+	if !ok {
+		return 0, os.ErrNotExist
+	}
+	return storyID, nil
+}
+
+func (s *MemoryMappingStore) Put(ticketID string, storyID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mappings[ticketID] = storyID
+	return nil
+}
+
+func (s *MemoryMappingStore) Delete(ticketID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.mappings, ticketID)
+	return nil
+}
+
+var mappingBucket = []byte("tickets")
+
+// BoltMappingStore keeps the mappings in a BoltDB file
+type BoltMappingStore struct {
+	db *bolt.DB
+}
+
+func NewBoltMappingStore(path string) (*BoltMappingStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(mappingBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltMappingStore{db}, nil
+}
+
+func (s *BoltMappingStore) Get(ticketID string) (int, error) {
+	var storyID int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(mappingBucket).Get([]byte(ticketID))
+		if value == nil {
+			return os.ErrNotExist
+		}
+		var err error
+		storyID, err = strconv.Atoi(string(value))
+		return err
+	})
+	return storyID, err
+}
+
+func (s *BoltMappingStore) Put(ticketID string, storyID int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(mappingBucket).Put([]byte(ticketID), []byte(strconv.Itoa(storyID)))
+	})
+}
+
+func (s *BoltMappingStore) Delete(ticketID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(mappingBucket).Delete([]byte(ticketID))
+	})
+}
+
+func (s *BoltMappingStore) Close() error {
+	return s.db.Close()
+}
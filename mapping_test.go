@@ -0,0 +1,98 @@
+package cloudfunction
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestMappingStore(t *testing.T) {
+	boltStore, err := NewBoltMappingStore(filepath.Join(t.TempDir(), "mappings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer boltStore.Close()
+
+	stores := map[string]MappingStore{
+		"memory": NewMemoryMappingStore(),
+		"bolt":   boltStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.Get("7777"); err != os.ErrNotExist {
+				t.Fatalf("got: %v, want: %v", err, os.ErrNotExist)
+			}
+			if err := store.Put("7777", 777); err != nil {
+				t.Fatal(err)
+			}
+			if storyID, err := store.Get("7777"); err != nil || storyID != 777 {
+				t.Fatalf("got: %d %v, want: 777", storyID, err)
+			}
+			if err := store.Delete("7777"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get("7777"); err != os.ErrNotExist {
+				t.Fatalf("got: %v, want: %v", err, os.ErrNotExist)
+			}
+		})
+	}
+}
+
+func Test_findStory(t *testing.T) {
+	tests := map[string]struct {
+		mappedStoryID int
+		storyStatus   int
+		searchBody    string
+		dryRun        bool
+		wantStoryID   int
+		wantMapping   int
+		wantErr       bool
+	}{
+		"mapped story":                  {111, 200, `[]`, false, 111, 111, false},
+		"unmapped story is searched":    {0, 200, `[{"id": 222}]`, false, 222, 222, false},
+		"stale mapping is repaired":     {111, 404, `[{"id": 222}]`, false, 222, 222, false},
+		"stale mapping is dropped":      {111, 404, `[]`, false, 0, 0, true},
+		"stale mapping kept in dry run": {111, 404, `[{"id": 222}]`, true, 222, 111, false},
+		"no story at all":               {0, 200, `[]`, false, 0, 0, true},
+	}
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	defer SetMappingStore(NewMemoryMappingStore())
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var story = ClubHouseStory{}
+			store := NewMemoryMappingStore()
+			SetMappingStore(store)
+			if tt.mappedStoryID != 0 {
+				store.Put("7777", tt.mappedStoryID)
+			}
+			httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/stories/111",
+				httpmock.NewStringResponder(tt.storyStatus, `{"id": 111}`))
+			httpmock.RegisterResponder("POST", ClubHouseAPIURL+"/api/v3/stories/search",
+				httpmock.NewStringResponder(201, tt.searchBody))
+
+			ctx := context.Background()
+			var plan = &DryRunPlan{}
+			if tt.dryRun {
+				ctx = withDryRun(ctx, plan)
+			}
+			err := findStory(ctx, &ClubHouse{"test"}, &ZendeskTicket{ID: "7777"}, &story)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findStory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if story.ID != tt.wantStoryID {
+				t.Fatalf("got story %d, want %d", story.ID, tt.wantStoryID)
+			}
+			if storyID, _ := store.Get("7777"); storyID != tt.wantMapping {
+				t.Fatalf("got mapping %d, want %d", storyID, tt.wantMapping)
+			}
+			if tt.dryRun && plan.StaleMapping != tt.mappedStoryID {
+				t.Fatalf("got stale mapping %d in the plan, want %d", plan.StaleMapping, tt.mappedStoryID)
+			}
+		})
+	}
+}
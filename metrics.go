@@ -0,0 +1,177 @@
+package cloudfunction
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	webhooksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "zendesk_clubhouse_webhooks_total",
+		Help: "Incoming Zendesk webhooks by action and outcome.",
+	}, []string{"action", "outcome"})
+
+	eventsProcessedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "zendesk_clubhouse_events_processed_total",
+		Help: "Queued events processed by the workers by action and outcome.",
+	}, []string{"action", "outcome"})
+
+	clubhouseRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "zendesk_clubhouse_api_requests_total",
+		Help: "Clubhouse API calls by endpoint and status.",
+	}, []string{"method", "endpoint", "status"})
+
+	clubhouseRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "zendesk_clubhouse_api_request_duration_seconds",
+		Help:    "Latency of Clubhouse API calls by endpoint.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "endpoint"})
+
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "zendesk_clubhouse_retries_total",
+		Help: "Retried queued events by action.",
+	}, []string{"action"})
+
+	metadataCacheTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "zendesk_clubhouse_metadata_cache_requests_total",
+		Help: "Clubhouse metadata lookups by kind and cache result (hit or miss).",
+	}, []string{"kind", "result"})
+
+	queueDepth = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "zendesk_clubhouse_queue_depth",
+		Help: "Events waiting in the work queue.",
+	}, func() float64 {
+		if eventQueue == nil {
+			return 0
+		}
+		return float64(eventQueue.Len())
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		webhooksTotal,
+		eventsProcessedTotal,
+		clubhouseRequestsTotal,
+		clubhouseRequestDuration,
+		retriesTotal,
+		metadataCacheTotal,
+		queueDepth,
+	)
+}
+
+// MetricsHandler serves the metrics in the Prometheus exposition format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+var metricsOnce sync.Once
+
+// InitMetrics sets up how the metrics leave the process. Servers are scraped
+// on /metrics, functions can not be and push them in the background every
+// METRICS_PUSH_INTERVAL (default 30s) when METRICS_PUSHGATEWAY_URL is set,
+// never on the request path
+func InitMetrics(ctx context.Context, push bool) {
+	metricsOnce.Do(func() {
+		url := os.Getenv("METRICS_PUSHGATEWAY_URL")
+		if !push || url == "" {
+			return
+		}
+		interval, err := time.ParseDuration(getEnv("METRICS_PUSH_INTERVAL", "30s"))
+		if err != nil || interval <= 0 {
+			slog.Error("Invalid METRICS_PUSH_INTERVAL, metrics push disabled", "interval", os.Getenv("METRICS_PUSH_INTERVAL"))
+			return
+		}
+
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					pushMetrics(ctx, url)
+				}
+			}
+		}()
+	})
+}
+
+// pushMetrics sends the metrics to the Pushgateway at url, each instance
+// pushes its own group
+func pushMetrics(ctx context.Context, url string) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	instance, _ := os.Hostname()
+	err := push.New(url, getEnv("METRICS_JOB", "zendesk_clubhouse_adapter")).
+		Gatherer(metricsRegistry).
+		Grouping("instance", instance).
+		PushContext(ctx)
+	if err != nil {
+		slog.Warn("Fail to push metrics", "error", err)
+	}
+}
+
+func webhookOutcome(err error) string {
+	switch err {
+	case nil:
+		return "success"
+	case os.ErrInvalid:
+		return "invalid"
+	case os.ErrNotExist:
+		return "not_found"
+	case ErrStoryConflict:
+		return "conflict"
+	}
+	return "error"
+}
+
+var endpointIDPattern = regexp.MustCompile(`/([0-9]+|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})(/|$)`)
+
+// endpointLabel replaces IDs in the path, so every story shares one label
+func endpointLabel(path string) string {
+	for endpointIDPattern.MatchString(path) {
+		path = endpointIDPattern.ReplaceAllString(path, "/{id}$2")
+	}
+	return path
+}
+
+// instrumentedTransport records every Clubhouse API call, it resolves
+// http.DefaultTransport on each call so test transports still apply
+type instrumentedTransport struct{}
+
+func (instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := endpointLabel(req.URL.Path)
+	start := time.Now()
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+
+	clubhouseRequestDuration.WithLabelValues(req.Method, endpoint).Observe(time.Since(start).Seconds())
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	} else {
+		slog.Debug("Clubhouse request failed", "endpoint", endpoint, "error", err)
+	}
+	clubhouseRequestsTotal.WithLabelValues(req.Method, endpoint, status).Inc()
+	return resp, err
+}
+
+var httpClient = &http.Client{Transport: instrumentedTransport{}, Timeout: 30 * time.Second}
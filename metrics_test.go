@@ -0,0 +1,121 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_endpointLabel(t *testing.T) {
+	tests := map[string]string{
+		"/api/v3/stories/777":                                  "/api/v3/stories/{id}",
+		"/api/v3/stories/777/comments":                         "/api/v3/stories/{id}/comments",
+		"/api/v3/members/12345678-9012-3456-7890-123456789012": "/api/v3/members/{id}",
+		"/api/v3/workflows":                                    "/api/v3/workflows",
+		"/api/v3/stories/search":                               "/api/v3/stories/search",
+	}
+	for path, want := range tests {
+		if got := endpointLabel(path); got != want {
+			t.Errorf("endpointLabel(%s) got = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestInstrumentedTransport(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/stories/777",
+		httpmock.NewStringResponder(200, `{"id": 777}`))
+
+	counter := clubhouseRequestsTotal.WithLabelValues("GET", "/api/v3/stories/{id}", "200")
+	before := testutil.ToFloat64(counter)
+
+	if err := (&ClubHouse{"test"}).GetStory(777, new(ClubHouseStory)); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Fatalf("got %v recorded calls, want 1", got)
+	}
+}
+
+func TestCachedClubHouse(t *testing.T) {
+	hits := metadataCacheTotal.WithLabelValues("project", "hit")
+	misses := metadataCacheTotal.WithLabelValues("project", "miss")
+	hitsBefore, missesBefore := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+
+	clubhouse := &cachedClubHouse{&MockClubHouse{"MOCK_CLUBHOUSE"}, "cache-test"}
+	for i := 0; i < 3; i++ {
+		if id, err := clubhouse.GetProjectByName("Support"); err != nil || id != 55 {
+			t.Fatalf("got: %d %v, want: 55", id, err)
+		}
+	}
+
+	if got := testutil.ToFloat64(misses) - missesBefore; got != 1 {
+		t.Fatalf("got %v cache misses, want 1", got)
+	}
+	if got := testutil.ToFloat64(hits) - hitsBefore; got != 2 {
+		t.Fatalf("got %v cache hits, want 2", got)
+	}
+}
+
+func TestCachedClubHouse_notMember(t *testing.T) {
+	misses := metadataCacheTotal.WithLabelValues("member", "miss")
+	missesBefore := testutil.ToFloat64(misses)
+
+	clubhouse := &cachedClubHouse{&MockClubHouse{"MOCK_CLUBHOUSE"}, "member-cache-test"}
+	for i := 0; i < 3; i++ {
+		if err := clubhouse.GetMemberByEmail("nobody@example.com", new(ClubHouseMember)); err != os.ErrNotExist {
+			t.Fatalf("got: %v, want: %v", err, os.ErrNotExist)
+		}
+	}
+
+	if got := testutil.ToFloat64(misses) - missesBefore; got != 1 {
+		t.Fatalf("got %v cache misses, want 1", got)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	os.Setenv("AUTH_USER", "")
+	os.Setenv("AUTH_PASSWORD", "")
+	before := testutil.ToFloat64(webhooksTotal.WithLabelValues(ActionCreate, "invalid"))
+
+	w := httptest.NewRecorder()
+	ZendeskClubhouseAdapter(w, httptest.NewRequest(http.MethodPost, "/tickets", bytes.NewBuffer([]byte(`{}`))))
+	if got := testutil.ToFloat64(webhooksTotal.WithLabelValues(ActionCreate, "invalid")) - before; got != 1 {
+		t.Fatalf("got %v invalid webhooks, want 1", got)
+	}
+
+	w = httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, name := range []string{"zendesk_clubhouse_webhooks_total", "zendesk_clubhouse_queue_depth"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("metrics should contain %s", name)
+		}
+	}
+}
+
+func TestWorkerPool_outcome(t *testing.T) {
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	success := eventsProcessedTotal.WithLabelValues(ActionComment, "success")
+	webhooks := webhooksTotal.WithLabelValues(ActionComment, "success")
+	before, webhooksBefore := testutil.ToFloat64(success), testutil.ToFloat64(webhooks)
+
+	pool := &WorkerPool{Queue: NewMemoryQueue(), MaxAttempts: 1}
+	pool.handle(context.Background(), NewEvent(ActionComment, ZendeskTicket{ID: "7777", Description: "Hello world"}))
+	if got := testutil.ToFloat64(success) - before; got != 1 {
+		t.Fatalf("got %v processed events, want 1", got)
+	}
+	// The webhook was counted as queued already
+	if got := testutil.ToFloat64(webhooks) - webhooksBefore; got != 0 {
+		t.Fatalf("got %v more webhooks, want none", got)
+	}
+}
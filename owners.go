@@ -0,0 +1,92 @@
+package cloudfunction
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ZendeskUser is the assignee or requester of a ticket
+type ZendeskUser struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// fallbackOwner is the email of the owner of stories whose ticket has no
+// assignee in Clubhouse. CLUBHOUSE_FALLBACK_OWNERS lists them per team as
+// comma separated team=email pairs, a bare email applies to any other team
+func fallbackOwner(team string) string {
+	var owner string
+	for _, entry := range strings.Split(os.Getenv("CLUBHOUSE_FALLBACK_OWNERS"), ",") {
+		name, email, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			owner = name
+		} else if strings.EqualFold(name, team) {
+			return email
+		}
+	}
+	return owner
+}
+
+// memberID is the Clubhouse member of a Zendesk user, empty if there is none.
+// Customers are not members, failed lookups only cost the ticket its owner
+func memberID(ctx context.Context, clubhouse AbstractClubHouse, user *ZendeskUser) string {
+	var member = ClubHouseMember{}
+
+	if user == nil || user.Email == "" {
+		return ""
+	}
+	err := clubhouse.GetMemberByEmail(user.Email, &member)
+	if err == os.ErrNotExist {
+		return ""
+	}
+	if err != nil {
+		loggerFrom(ctx).Warn("Fail to look up member", "error", err)
+		return ""
+	}
+	return member.ID
+}
+
+// storyPeople maps the assignee to the owner, or the fallback owner of the
+// team, and the requester to a follower of a new story
+func storyPeople(ctx context.Context, clubhouse AbstractClubHouse, zendeskTicket *ZendeskTicket, team string, story *ClubHouseStory) {
+	owner := memberID(ctx, clubhouse, zendeskTicket.Assignee)
+	if owner == "" {
+		if email := fallbackOwner(team); email != "" {
+			owner = memberID(ctx, clubhouse, &ZendeskUser{Email: email})
+		}
+	}
+	if owner != "" {
+		story.OwnerIDs = []string{owner}
+	}
+
+	if follower := memberID(ctx, clubhouse, zendeskTicket.Requester); follower != "" && follower != owner {
+		story.FollowerIDs = []string{follower}
+	}
+}
+
+// syncOwners makes the assignee the owner of the story once the ticket is
+// assigned to someone who does not own it yet. The first owner is the one the
+// adapter set, the assignee or the fallback owner, and the only one replaced,
+// owners added in Clubhouse stay. Unassigned tickets leave the owners alone
+func syncOwners(ctx context.Context, clubhouse AbstractClubHouse, zendeskTicket *ZendeskTicket, story *ClubHouseStory) error {
+	owner := memberID(ctx, clubhouse, zendeskTicket.Assignee)
+	if owner == "" || slices.Contains(story.OwnerIDs, owner) {
+		return nil
+	}
+
+	owners := []string{owner}
+	if len(story.OwnerIDs) > 1 {
+		owners = append(owners, story.OwnerIDs[1:]...)
+	}
+
+	err := clubhouse.UpdateStoryOwners(story.ID, owners)
+	if err != nil {
+		return err
+	}
+	audit(ctx, AuditEntry{Action: AuditOwnersChanged, TicketID: zendeskTicket.ID, StoryID: story.ID,
+		Before: strings.Join(story.OwnerIDs, ","), After: owner})
+	story.OwnerIDs = owners
+	return nil
+}
@@ -0,0 +1,90 @@
+package cloudfunction
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_fallbackOwner(t *testing.T) {
+	tests := map[string]struct {
+		owners string
+		team   string
+		want   string
+	}{
+		"team owner":    {"Support=lead@example.com, Platform=ops@example.com", "platform", "ops@example.com"},
+		"default owner": {"Support=lead@example.com,triage@example.com", "Platform", "triage@example.com"},
+		"no owner":      {"Support=lead@example.com", "Platform", ""},
+		"not set":       {"", "Support", ""},
+	}
+
+	defer os.Unsetenv("CLUBHOUSE_FALLBACK_OWNERS")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			os.Setenv("CLUBHOUSE_FALLBACK_OWNERS", tt.owners)
+			if got := fallbackOwner(tt.team); got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_storyPeople(t *testing.T) {
+	tests := map[string]struct {
+		assignee      *ZendeskUser
+		requester     *ZendeskUser
+		wantOwners    []string
+		wantFollowers []string
+	}{
+		"assignee and requester": {&ZendeskUser{"Jane", "jane@example.com"}, &ZendeskUser{"John", "john@example.com"},
+			[]string{"member-jane@example.com"}, []string{"member-john@example.com"}},
+		"customer requester":  {&ZendeskUser{"Jane", "jane@example.com"}, &ZendeskUser{"Customer", "nobody@example.com"}, []string{"member-jane@example.com"}, nil},
+		"unassigned":          {nil, nil, []string{"member-lead@example.com"}, nil},
+		"assignee not member": {&ZendeskUser{"Contractor", "nobody@example.com"}, nil, []string{"member-lead@example.com"}, nil},
+		"assignee requested":  {&ZendeskUser{"Jane", "jane@example.com"}, &ZendeskUser{"Jane", "jane@example.com"}, []string{"member-jane@example.com"}, nil},
+	}
+
+	os.Setenv("CLUBHOUSE_FALLBACK_OWNERS", "Support=lead@example.com")
+	defer os.Unsetenv("CLUBHOUSE_FALLBACK_OWNERS")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var story = ClubHouseStory{}
+			ticket := ZendeskTicket{ID: "7777", Assignee: tt.assignee, Requester: tt.requester}
+			storyPeople(context.Background(), &MockClubHouse{}, &ticket, "Support", &story)
+			if !reflect.DeepEqual(story.OwnerIDs, tt.wantOwners) || !reflect.DeepEqual(story.FollowerIDs, tt.wantFollowers) {
+				t.Errorf("got: %v %v, want: %v %v", story.OwnerIDs, story.FollowerIDs, tt.wantOwners, tt.wantFollowers)
+			}
+		})
+	}
+}
+
+func Test_syncOwners(t *testing.T) {
+	tests := map[string]struct {
+		assignee   *ZendeskUser
+		owners     []string
+		wantOwners []string
+	}{
+		"reassigned":              {&ZendeskUser{"John", "john@example.com"}, []string{"member-jane@example.com"}, []string{"member-john@example.com"}},
+		"fallback owner replaced": {&ZendeskUser{"John", "john@example.com"}, []string{"member-lead@example.com"}, []string{"member-john@example.com"}},
+		"added in Shortcut":       {&ZendeskUser{"John", "john@example.com"}, []string{"member-jane@example.com", "member-dev@example.com"}, []string{"member-john@example.com", "member-dev@example.com"}},
+		"already owner":           {&ZendeskUser{"Jane", "jane@example.com"}, []string{"member-john@example.com", "member-jane@example.com"}, nil},
+		"unassigned":              {nil, []string{"member-jane@example.com"}, nil},
+		"not a member":            {&ZendeskUser{"Contractor", "nobody@example.com"}, nil, nil},
+		"first assignment":        {&ZendeskUser{"Jane", "jane@example.com"}, nil, []string{"member-jane@example.com"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			clubhouse := &recordingClubHouse{}
+			ticket := ZendeskTicket{ID: "7777", Assignee: tt.assignee}
+			err := syncOwners(context.Background(), clubhouse, &ticket, &ClubHouseStory{ID: 777, OwnerIDs: tt.owners})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(clubhouse.owners, tt.wantOwners) {
+				t.Errorf("got: %v, want: %v", clubhouse.owners, tt.wantOwners)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Zendesk webhook payloads are written by hand in the webhook body, with
+// placeholders which render numbers, lists and dates in more than one way.
+// The lenient types below accept every rendering seen in the wild, values
+// which still do not make sense are dropped rather than failing the webhook
+
+// lenientString is a string which may be sent as a number
+type lenientString string
+
+func (s *lenientString) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	*s = lenientString(scalarString(value))
+	return nil
+}
+
+// lenientBool is a bool which may be sent as a string
+type lenientBool bool
+
+func (b *lenientBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case bool:
+		*b = lenientBool(value)
+	case string:
+		parsed, _ := strconv.ParseBool(strings.TrimSpace(value))
+		*b = lenientBool(parsed)
+	}
+	return nil
+}
+
+// lenientTime is a timestamp in any of timeLayouts, nil if it is in none
+type lenientTime struct {
+	time *time.Time
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"January 2, 2006 15:04",
+	"2006-01-02",
+}
+
+func (t *lenientTime) UnmarshalJSON(data []byte) error {
+	var value string
+	if json.Unmarshal(data, &value) != nil {
+		return nil
+	}
+	for _, layout := range timeLayouts {
+		parsed, err := time.Parse(layout, strings.TrimSpace(value))
+		if err == nil {
+			t.time = &parsed
+			return nil
+		}
+	}
+	return nil
+}
+
+// scalarString renders a JSON value as text, lists are comma separated
+func scalarString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			values = append(values, scalarString(v))
+		}
+		return strings.Join(values, ",")
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// ZendeskTags are the ticket tags, sent as a list or as the space separated
+// string of the {{ticket.tags}} placeholder
+type ZendeskTags []string
+
+func (t *ZendeskTags) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	*t = nil
+	switch value := value.(type) {
+	case string:
+		*t = strings.Fields(strings.ReplaceAll(value, ",", " "))
+	case []interface{}:
+		for _, tag := range value {
+			if tag := strings.TrimSpace(scalarString(tag)); tag != "" {
+				*t = append(*t, tag)
+			}
+		}
+	}
+	return nil
+}
+
+// ZendeskCustomFields are the values of the ticket custom fields by field
+// name or ID, sent as an object or as the list of {id, value} of the API
+type ZendeskCustomFields map[string]string
+
+func (f *ZendeskCustomFields) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	*f = ZendeskCustomFields{}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for name, v := range value {
+			(*f)[name] = scalarString(v)
+		}
+	case []interface{}:
+		for _, field := range value {
+			field, ok := field.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key := scalarString(field["name"])
+			if key == "" {
+				key = scalarString(field["id"])
+			}
+			if key != "" {
+				(*f)[key] = scalarString(field["value"])
+			}
+		}
+	}
+	return nil
+}
+
+// Get is the value of a field by name or ID, names are matched case insensitively
+func (f ZendeskCustomFields) Get(name string) string {
+	if value, ok := f[name]; ok {
+		return value
+	}
+	for key, value := range f {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// ZendeskSLATarget is when an SLA metric of the ticket, e.g. agent_work_time, breaches
+type ZendeskSLATarget struct {
+	Metric   string     `json:"metric,omitempty"`
+	BreachAt *time.Time `json:"breach_at"`
+}
+
+// ZendeskSLATargets are sent as a list of targets, a single target or only the breach time
+type ZendeskSLATargets []ZendeskSLATarget
+
+func (s *ZendeskSLATargets) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	var targets []struct {
+		Metric   lenientString `json:"metric"`
+		BreachAt lenientTime   `json:"breach_at"`
+	}
+	*s = nil
+	switch raw.(type) {
+	case string:
+		var breachAt lenientTime
+		breachAt.UnmarshalJSON(data)
+		if breachAt.time != nil {
+			*s = ZendeskSLATargets{{BreachAt: breachAt.time}}
+		}
+		return nil
+	case map[string]interface{}:
+		data = append(append([]byte("["), data...), ']')
+	case []interface{}:
+	default:
+		return nil
+	}
+	if json.Unmarshal(data, &targets) != nil {
+		return nil
+	}
+	for _, target := range targets {
+		if target.BreachAt.time != nil {
+			*s = append(*s, ZendeskSLATarget{string(target.Metric), target.BreachAt.time})
+		}
+	}
+	return nil
+}
+
+func (u *ZendeskUser) UnmarshalJSON(data []byte) error {
+	type plain ZendeskUser
+
+	// A bare string is the email, or the name, of the user
+	var value string
+	if json.Unmarshal(data, &value) == nil {
+		value = strings.TrimSpace(value)
+		if strings.Contains(value, "@") {
+			*u = ZendeskUser{Email: value}
+		} else {
+			*u = ZendeskUser{Name: value}
+		}
+		return nil
+	}
+	return json.Unmarshal(data, (*plain)(u))
+}
+
+func (c *ZendeskComment) UnmarshalJSON(data []byte) error {
+	type plain ZendeskComment
+	var payload struct {
+		*plain
+		ID     lenientString `json:"id"`
+		Public *lenientBool  `json:"public"`
+	}
+
+	payload.plain = (*plain)(c)
+	err := json.Unmarshal(data, &payload)
+	if err != nil {
+		return err
+	}
+	c.ID = string(payload.ID)
+	if payload.Public != nil {
+		c.Public = bool(*payload.Public)
+	}
+	return nil
+}
+
+func (t *ZendeskTicket) UnmarshalJSON(data []byte) error {
+	type plain ZendeskTicket
+	var payload struct {
+		*plain
+		ID        lenientString `json:"id"`
+		CreatedAt lenientTime   `json:"created_at"`
+		UpdatedAt lenientTime   `json:"updated_at"`
+	}
+
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil
+	}
+	payload.plain = (*plain)(t)
+	err := json.Unmarshal(data, &payload)
+	if err != nil {
+		return fmt.Errorf("invalid ticket: %w", err)
+	}
+	t.ID = string(payload.ID)
+	t.CreatedAt, t.UpdatedAt = payload.CreatedAt.time, payload.UpdatedAt.time
+	// Placeholders render these capitalized, e.g. Open or Urgent
+	t.Status = strings.ToLower(strings.TrimSpace(t.Status))
+	t.PreviousStatus = strings.ToLower(strings.TrimSpace(t.PreviousStatus))
+	t.Priority = strings.ToLower(strings.TrimSpace(t.Priority))
+	t.Type = strings.ToLower(strings.TrimSpace(t.Type))
+	return nil
+}
+
+// ticketValue is the value of a ticket field, as used by custom field mappings,
+// epic rules and the story name template: org, status, priority, type, group,
+// brand, requester or assignee (their email), field:<custom field>, or
+// tag:<prefix> for the rest of the first tag with the prefix
+func ticketValue(zendeskTicket *ZendeskTicket, from string) string {
+	switch from {
+	case "org":
+		return zendeskTicket.Organization
+	case "status":
+		return zendeskTicket.Status
+	case "priority":
+		return zendeskTicket.Priority
+	case "type":
+		return zendeskTicket.Type
+	case "group":
+		return zendeskTicket.Group
+	case "brand":
+		return zendeskTicket.Brand
+	case "requester":
+		if zendeskTicket.Requester != nil {
+			return zendeskTicket.Requester.Email
+		}
+		return ""
+	case "assignee":
+		if zendeskTicket.Assignee != nil {
+			return zendeskTicket.Assignee.Email
+		}
+		return ""
+	}
+
+	if name, ok := strings.CutPrefix(from, "field:"); ok {
+		return zendeskTicket.CustomFields.Get(name)
+	}
+	if prefix, ok := strings.CutPrefix(from, "tag:"); ok {
+		for _, tag := range zendeskTicket.Tags {
+			if value, ok := strings.CutPrefix(strings.ToLower(tag), strings.ToLower(prefix)); ok && value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// storyNameTemplate parses STORY_NAME_TEMPLATE, a text/template of the ticket,
+// e.g. {{.Organization}} / {{value "priority"}} / {{.Title}} where value is
+// ticketValue. Nil without template
+func storyNameTemplate() (*template.Template, error) {
+	text := getEnv("STORY_NAME_TEMPLATE", "")
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("story_name").Funcs(template.FuncMap{
+		"value": func(from string) string { return "" },
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid STORY_NAME_TEMPLATE: %w", err)
+	}
+	return tmpl, nil
+}
+
+// storyName renders the story name template for the ticket, without template
+// the name is the given default
+func storyName(tmpl *template.Template, zendeskTicket *ZendeskTicket, name string) (string, error) {
+	var rendered strings.Builder
+
+	if tmpl == nil {
+		return name, nil
+	}
+	// The value function is bound to the ticket on a copy, requests run concurrently
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(template.FuncMap{
+		"value": func(from string) string { return ticketValue(zendeskTicket, from) },
+	})
+	err = tmpl.Execute(&rendered, zendeskTicket)
+	if err != nil {
+		return "", fmt.Errorf("invalid STORY_NAME_TEMPLATE: %w", err)
+	}
+	return strings.TrimSpace(rendered.String()), nil
+}
@@ -0,0 +1,127 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestZendeskTicket_UnmarshalJSON(t *testing.T) {
+	created := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		payload string
+		want    ZendeskTicket
+		wantErr bool
+	}{
+		"legacy payload": {
+			`{"title": "unit test", "id": "7777", "status": "open", "unknown": {"nested": true}}`,
+			ZendeskTicket{Title: "unit test", ID: "7777", Status: "open"},
+			false,
+		},
+		"numeric IDs and string tags": {
+			`{"id": 7777, "status": "Pending", "priority": "Urgent", "type": "Incident", "tags": "vip billing", "comment": {"id": 42, "public": "true", "body": "Hi"}}`,
+			ZendeskTicket{ID: "7777", Status: "pending", Priority: "urgent", Type: "incident", Tags: ZendeskTags{"vip", "billing"}, Comment: &ZendeskComment{ID: "42", Public: true, Body: "Hi"}},
+			false,
+		},
+		"people and custom fields": {
+			`{"id": "1", "requester": "jane@example.com", "assignee": {"name": "Bob", "email": "bob@example.com"}, "group": "Billing", "brand": "InfuseAI",
+			  "custom_fields": [{"id": 360001, "value": "enterprise"}, {"name": "Region", "value": ["eu", "us"]}, {"id": 360002, "value": null}]}`,
+			ZendeskTicket{ID: "1", Requester: &ZendeskUser{Email: "jane@example.com"}, Assignee: &ZendeskUser{Name: "Bob", Email: "bob@example.com"}, Group: "Billing", Brand: "InfuseAI",
+				CustomFields: ZendeskCustomFields{"360001": "enterprise", "Region": "eu,us", "360002": ""}},
+			false,
+		},
+		"custom fields object and timestamps": {
+			`{"id": "1", "tags": ["vip", 42], "custom_fields": {"Plan": "pro", "Seats": 25}, "created_at": "2024-01-15T10:00:00Z", "updated_at": "yesterday"}`,
+			ZendeskTicket{ID: "1", Tags: ZendeskTags{"vip", "42"}, CustomFields: ZendeskCustomFields{"Plan": "pro", "Seats": "25"}, CreatedAt: &created},
+			false,
+		},
+		"SLA targets": {
+			`{"id": "1", "sla": [{"metric": "agent_work_time", "breach_at": "2024-01-15T10:00:00Z"}, {"metric": "first_reply_time", "breach_at": ""}]}`,
+			ZendeskTicket{ID: "1", SLA: ZendeskSLATargets{{Metric: "agent_work_time", BreachAt: &created}}},
+			false,
+		},
+		"SLA breach time": {
+			`{"id": "1", "sla": {"breach_at": "2024-01-15 10:00:00"}}`,
+			ZendeskTicket{ID: "1", SLA: ZendeskSLATargets{{BreachAt: &created}}},
+			false,
+		},
+		"SLA placeholder": {
+			`{"id": "1", "sla": "2024-01-15T10:00:00Z"}`,
+			ZendeskTicket{ID: "1", SLA: ZendeskSLATargets{{BreachAt: &created}}},
+			false,
+		},
+		"malformed": {`{"id": "1", "title": 5}`, ZendeskTicket{}, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got ZendeskTicket
+			err := json.Unmarshal([]byte(tt.payload), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got: %+v, want: %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ticketValue(t *testing.T) {
+	ticket := ZendeskTicket{
+		Organization: "InfuseAI",
+		Priority:     "high",
+		Requester:    &ZendeskUser{Name: "Jane", Email: "jane@example.com"},
+		Tags:         ZendeskTags{"vip", "Tier_Pro"},
+		CustomFields: ZendeskCustomFields{"Plan": "enterprise"},
+	}
+	tests := map[string]string{
+		"org":        "InfuseAI",
+		"priority":   "high",
+		"requester":  "jane@example.com",
+		"assignee":   "",
+		"tag:tier_":  "pro",
+		"field:plan": "enterprise",
+		"unknown":    "",
+	}
+	for from, want := range tests {
+		if got := ticketValue(&ticket, from); got != want {
+			t.Errorf("ticketValue(%q) got: %q, want: %q", from, got, want)
+		}
+	}
+}
+
+func Test_storyName(t *testing.T) {
+	ticket := ZendeskTicket{Title: "Login fails", Organization: "InfuseAI", Priority: "urgent"}
+	tests := map[string]struct {
+		template    string
+		want        string
+		wantLoadErr bool
+		wantErr     bool
+	}{
+		"default":  {"", "[InfuseAI] Login fails", false, false},
+		"template": {`{{value "priority"}}: {{.Title}} ({{.Organization}})`, "urgent: Login fails (InfuseAI)", false, false},
+		"invalid":  {`{{.Title`, "", true, false},
+		"unknown":  {`{{.Subject}}`, "", false, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := setConfig(t, "STORY_NAME_TEMPLATE", tt.template)
+			if (err != nil) != tt.wantLoadErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantLoadErr)
+			}
+			if err != nil {
+				return
+			}
+			got, err := storyName(loadedConfig.Load().StoryName, &ticket, "[InfuseAI] Login fails")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("storyName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package cloudfunction
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionClose   = "close"
+	ActionComment = "comment"
+	ActionStatus  = "status"
+)
+
+// Event is a validated Zendesk webhook waiting to be synced to Clubhouse
+type Event struct {
+	ID            string            `json:"id"`
+	Action        string            `json:"action"`
+	Ticket        ZendeskTicket     `json:"ticket"`
+	Actor         string            `json:"actor"`
+	CorrelationID string            `json:"correlation_id,omitempty"`
+	TraceContext  map[string]string `json:"trace_context,omitempty"`
+	Attempts      int               `json:"attempts"`
+	EnqueuedAt    time.Time         `json:"enqueued_at"`
+}
+
+var eventActions = map[string]func(context.Context, *ZendeskTicket) error{
+	ActionCreate:  createTicket,
+	ActionUpdate:  updateTicket,
+	ActionClose:   closeTicket,
+	ActionComment: commentTicket,
+	ActionStatus:  updateTicketStatus,
+}
+
+func NewEvent(action string, zendeskTicket ZendeskTicket) *Event {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &Event{
+		ID:         hex.EncodeToString(id),
+		Action:     action,
+		Ticket:     zendeskTicket,
+		EnqueuedAt: time.Now().UTC(),
+	}
+}
+
+// validateEvent rejects events which would never succeed, without calling Clubhouse
+func validateEvent(event *Event) error {
+	if _, ok := eventActions[event.Action]; !ok {
+		return os.ErrInvalid
+	}
+	if os.Getenv("CH_TOKEN") == "" || event.Ticket.ID == "" {
+		return os.ErrInvalid
+	}
+	if event.Action == ActionCreate &&
+		(event.Ticket.Title == "" || event.Ticket.URL == "") {
+		return os.ErrInvalid
+	}
+	return nil
+}
+
+// ProcessEvent syncs an event to Clubhouse
+func ProcessEvent(ctx context.Context, event *Event) (err error) {
+	action, ok := eventActions[event.Action]
+	if !ok {
+		return os.ErrInvalid
+	}
+
+	ctx, span := tracer.Start(extractTraceContext(ctx, event), "process "+event.Action, trace.WithAttributes(
+		attribute.String("zendesk.ticket_id", event.Ticket.ID),
+		attribute.Int("event.attempt", event.Attempts),
+	))
+	defer func() { endSpan(span, err) }()
+
+	ctx = withCorrelation(ctx, event.CorrelationID)
+	ctx = withTicket(ctx, event.Ticket.ID)
+	ctx = withActor(ctx, event.Actor)
+	return action(ctx, &event.Ticket)
+}
+
+// Queue is a pull-style work queue in the manner of Pub/Sub: Dequeue hands out
+// the oldest event and it stays owned by the queue until acknowledged with Ack
+type Queue interface {
+	Enqueue(*Event) error
+	Dequeue(context.Context) (*Event, error)
+	Ack(*Event) error
+	Len() int
+}
+
+// eventQueue enables asynchronous processing when set, see SetQueue
+var eventQueue Queue
+
+// SetQueue makes the handler enqueue events instead of processing them inline,
+// the queue has to be consumed by a WorkerPool
+func SetQueue(queue Queue) {
+	eventQueue = queue
+}
+
+func QueueBuilder(kind string, dir string) (Queue, error) {
+	switch kind {
+	case "memory":
+		return NewMemoryQueue(), nil
+	case "file":
+		return NewFileQueue(dir)
+	}
+	return nil, fmt.Errorf("unknown queue %q", kind)
+}
+
+type MemoryQueue struct {
+	mu     sync.Mutex
+	events []*Event
+	notify chan struct{}
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{notify: make(chan struct{}, 1)}
+}
+
+func (q *MemoryQueue) Enqueue(event *Event) error {
+	q.mu.Lock()
+	q.events = append(q.events, event)
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *MemoryQueue) Dequeue(ctx context.Context) (*Event, error) {
+	for {
+		q.mu.Lock()
+		if len(q.events) > 0 {
+			event := q.events[0]
+			q.events = q.events[1:]
+			q.mu.Unlock()
+			return event, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.notify:
+		}
+	}
+}
+
+func (q *MemoryQueue) Ack(event *Event) error {
+	return nil
+}
+
+func (q *MemoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events)
+}
+
+// FileQueue keeps one file per event in Dir until it is acknowledged,
+// unacknowledged events are delivered again after a restart
+type FileQueue struct {
+	MemoryQueue
+	Dir string
+}
+
+func NewFileQueue(dir string) (*FileQueue, error) {
+	q := &FileQueue{Dir: dir}
+	q.notify = make(chan struct{}, 1)
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	// File names start with the enqueue time, so sorting restores the queue order
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		event := &Event{}
+		err = json.Unmarshal(data, event)
+		if err != nil {
+			slog.Error("Skip broken queue file", "file", file, "error", err)
+			continue
+		}
+		q.MemoryQueue.Enqueue(event)
+	}
+	return q, nil
+}
+
+func (q *FileQueue) path(event *Event) string {
+	return filepath.Join(q.Dir, fmt.Sprintf("%019d-%s.json", event.EnqueuedAt.UnixNano(), event.ID))
+}
+
+func (q *FileQueue) Enqueue(event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	// Write and rename, so a crash never leaves a partial event behind
+	path := q.path(event)
+	err = os.WriteFile(path+".tmp", data, 0o644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return err
+	}
+	return q.MemoryQueue.Enqueue(event)
+}
+
+// durableQueue is a queue which delivers unacknowledged events again after a
+// restart
+type durableQueue interface {
+	Queue
+	durable()
+}
+
+func (q *FileQueue) durable() {}
+
+func (q *FileQueue) Ack(event *Event) error {
+	err := os.Remove(q.path(event))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// WorkerPool processes queued events concurrently, events of the same ticket
+// always go to the same worker so they are processed in order. Failed events
+// are retried up to MaxAttempts times and then stored as dead letters
+type WorkerPool struct {
+	Queue       Queue
+	Workers     int
+	MaxAttempts int
+	RetryDelay  time.Duration
+}
+
+func shardFor(ticketID string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(ticketID)))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// Run blocks until ctx is cancelled, events already handed to a worker are
+// finished before it returns
+func (p *WorkerPool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	shards := make([]chan *Event, workers)
+	for i := range shards {
+		shards[i] = make(chan *Event, 16)
+		wg.Add(1)
+		go func(events chan *Event) {
+			defer wg.Done()
+			for event := range events {
+				p.handle(ctx, event)
+			}
+		}(shards[i])
+	}
+
+	for {
+		event, err := p.Queue.Dequeue(ctx)
+		if err != nil {
+			break
+		}
+		shards[shardFor(event.Ticket.ID, workers)] <- event
+	}
+
+	for _, events := range shards {
+		close(events)
+	}
+	wg.Wait()
+}
+
+// handle processes an event until it succeeds or runs out of attempts. Events
+// are processed to the end on shutdown, only the wait for a retry is cut short
+// and leaves the event unacknowledged for the next start, events of a memory
+// queue are dropped
+func (p *WorkerPool) handle(poolCtx context.Context, event *Event) {
+	ctx := withCorrelation(context.Background(), event.CorrelationID)
+	logger := loggerFrom(ctx).With("ticket_id", event.Ticket.ID, "action", event.Action, "event_id", event.ID)
+
+	var err error
+	for {
+		event.Attempts++
+		err = ProcessEvent(ctx, event)
+		if err == nil {
+			break
+		}
+		logger.Warn("Event failed", "attempt", event.Attempts, "error", err)
+
+		if !isRetryable(err) || event.Attempts >= p.MaxAttempts {
+			if needsDeadLetter(err) {
+				deadLetter(ctx, event, err)
+			}
+			break
+		}
+		// Retrying inline keeps later events of the ticket waiting behind this one
+		retriesTotal.WithLabelValues(event.Action).Inc()
+		timer := time.NewTimer(p.RetryDelay * time.Duration(event.Attempts))
+		select {
+		case <-poolCtx.Done():
+			timer.Stop()
+			if _, ok := p.Queue.(durableQueue); ok {
+				logger.Warn("Retry cancelled by shutdown, the event stays queued", "attempt", event.Attempts)
+				eventsProcessedTotal.WithLabelValues(event.Action, "interrupted").Inc()
+			} else {
+				logger.Error("Retry cancelled by shutdown, the event is dropped", "attempt", event.Attempts, "error", err)
+				eventsProcessedTotal.WithLabelValues(event.Action, "dropped").Inc()
+			}
+			return
+		case <-timer.C:
+		}
+	}
+	// The webhook was counted as queued, this is how its event ended
+	eventsProcessedTotal.WithLabelValues(event.Action, webhookOutcome(err)).Inc()
+
+	err = p.Queue.Ack(event)
+	if err != nil {
+		logger.Error("Fail to ack event", "error", err)
+	}
+}
@@ -0,0 +1,210 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFileQueue(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := NewFileQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := NewEvent(ActionCreate, ZendeskTicket{ID: "1"})
+	second := NewEvent(ActionUpdate, ZendeskTicket{ID: "1"})
+	second.EnqueuedAt = first.EnqueuedAt.Add(time.Millisecond)
+	for _, event := range []*Event{first, second} {
+		if err := queue.Enqueue(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	event, err := queue.Dequeue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != first.ID {
+		t.Fatalf("got: %s, want: %s", event.ID, first.ID)
+	}
+	if err := queue.Ack(event); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second event was never acknowledged, so a restart delivers it again
+	reopened, err := NewFileQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Len() != 1 {
+		t.Fatalf("got %d queued events, want 1", reopened.Len())
+	}
+	event, err = reopened.Dequeue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != second.ID || event.Action != ActionUpdate {
+		t.Fatalf("got: %s %s, want: %s %s", event.ID, event.Action, second.ID, ActionUpdate)
+	}
+}
+
+func TestMemoryQueue_DequeueCancelled(t *testing.T) {
+	queue := NewMemoryQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := queue.Dequeue(ctx); err == nil {
+		t.Fatal("Dequeue() on a cancelled context should fail")
+	}
+}
+
+func TestWorkerPool(t *testing.T) {
+	var mu sync.Mutex
+	var processed = map[string][]string{} // event sequence numbers by ticket
+	var count int
+
+	// The first events of a ticket are the slowest, a later one overtaking
+	// them would show in the order
+	defer func(action func(context.Context, *ZendeskTicket) error) { eventActions[ActionComment] = action }(eventActions[ActionComment])
+	eventActions[ActionComment] = func(ctx context.Context, zendeskTicket *ZendeskTicket) error {
+		delay, _ := strconv.Atoi(zendeskTicket.Description)
+		time.Sleep(time.Duration(10-delay) * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		processed[zendeskTicket.ID] = append(processed[zendeskTicket.ID], zendeskTicket.Description)
+		count++
+		return nil
+	}
+
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	queue := NewMemoryQueue()
+	for i, id := range []string{"1", "2", "3", "1", "2", "1"} {
+		queue.Enqueue(NewEvent(ActionComment, ZendeskTicket{ID: id, Description: strconv.Itoa(i)}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		(&WorkerPool{Queue: queue, Workers: 2}).Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		finished := count == 6
+		mu.Unlock()
+		if finished {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if queue.Len() != 0 {
+		t.Fatalf("got %d queued events, want 0", queue.Len())
+	}
+	want := map[string][]string{"1": {"0", "3", "5"}, "2": {"1", "4"}, "3": {"2"}}
+	if !reflect.DeepEqual(processed, want) {
+		t.Errorf("got: %v, want: %v", processed, want)
+	}
+}
+
+func TestZendeskClubhouseAdapter_Async(t *testing.T) {
+	tests := map[string]struct {
+		path       string
+		payload    string
+		wantStatus int
+		wantQueued int
+	}{
+		"enqueue create ticket":              {"/tickets", `{"title": "unit test", "id": "7777", "url": "http://unittest.io" }`, http.StatusAccepted, 1},
+		"create ticket with invalid payload": {"/tickets", `{"id": "7777"}`, http.StatusBadRequest, 0},
+		"enqueue legacy create ticket":       {"/", `{"title": "unit test", "id": "7777", "url": "http://unittest.io" }`, http.StatusAccepted, 1},
+	}
+
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	os.Setenv("AUTH_USER", "")
+	os.Setenv("AUTH_PASSWORD", "")
+	defer SetQueue(nil)
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			queue := NewMemoryQueue()
+			SetQueue(queue)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBuffer([]byte(tt.payload)))
+
+			ZendeskClubhouseAdapter(w, r)
+
+			if s := w.Result().StatusCode; s != tt.wantStatus {
+				t.Fatalf("got: %d, want: %d", s, tt.wantStatus)
+			}
+			if queue.Len() != tt.wantQueued {
+				t.Fatalf("got %d queued events, want %d", queue.Len(), tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestWorkerPool_RetryShutdown(t *testing.T) {
+	t.Setenv("DEAD_LETTER_DIR", t.TempDir())
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	failAction(t, ActionClose)
+	queue, err := NewFileQueue(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := NewEvent(ActionClose, ZendeskTicket{ID: "7777"})
+	queue.Enqueue(event)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The retry would wait for an hour
+	start := time.Now()
+	(&WorkerPool{Queue: queue, MaxAttempts: 3, RetryDelay: time.Hour}).handle(ctx, event)
+	if time.Since(start) > time.Second {
+		t.Fatalf("handle() waited %s for the retry after shutdown", time.Since(start))
+	}
+
+	if event.Attempts != 1 {
+		t.Errorf("got %d attempts, want 1", event.Attempts)
+	}
+	if deadLetters, _ := DeadLetters().List(); len(deadLetters) != 0 {
+		t.Errorf("got %d dead letters, want none", len(deadLetters))
+	}
+	reopened, err := NewFileQueue(queue.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Len() != 1 {
+		t.Errorf("got %d queued events, the event should stay queued", reopened.Len())
+	}
+}
+
+func TestWorkerPool_RetryShutdownMemory(t *testing.T) {
+	t.Setenv("DEAD_LETTER_DIR", t.TempDir())
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	failAction(t, ActionClose)
+	dropped := eventsProcessedTotal.WithLabelValues(ActionClose, "dropped")
+	before := testutil.ToFloat64(dropped)
+	event := NewEvent(ActionClose, ZendeskTicket{ID: "7777"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A memory queue is gone with the process, the event is counted as dropped
+	(&WorkerPool{Queue: NewMemoryQueue(), MaxAttempts: 3, RetryDelay: time.Hour}).handle(ctx, event)
+	if got := testutil.ToFloat64(dropped) - before; got != 1 {
+		t.Errorf("got %v dropped events, want 1", got)
+	}
+}
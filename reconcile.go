@@ -0,0 +1,200 @@
+package cloudfunction
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DriftStateMismatch = "state_mismatch" // the story is not in the state of the ticket status
+	DriftStoryDone     = "story_done"     // the ticket is open but its story is done
+	DriftTicketMissing = "ticket_missing" // the ticket of the story was deleted
+	DriftCheckFailed   = "check_failed"   // the story could not be compared with its ticket
+)
+
+// Drift is a story out of sync with its ticket, missing tickets cannot be fixed
+type Drift struct {
+	TicketID      string `json:"ticket_id"`
+	StoryID       int    `json:"story_id"`
+	Problem       string `json:"problem"`
+	TicketStatus  string `json:"ticket_status,omitempty"`
+	StoryState    string `json:"story_state,omitempty"`
+	ExpectedState string `json:"expected_state,omitempty"`
+	Fixed         bool   `json:"fixed"`
+	Error         string `json:"error,omitempty"`
+}
+
+type ReconcileOptions struct {
+	Fix  bool
+	Rate float64 // tickets per second, 0 for no limit
+}
+
+type ReconcileReport struct {
+	Checked int     `json:"checked"`
+	Fixed   int     `json:"fixed"`
+	Drifts  []Drift `json:"drifts"`
+}
+
+// projectStories collects the stories of a project matching a search query.
+// Projects with more matches than the search returns are listed in full, keep
+// then stands in for the query
+func projectStories(clubhouse AbstractClubHouse, project string, query string, keep func(*ClubHouseStory) bool, stories *[]ClubHouseStory) error {
+	var all []ClubHouseStory
+
+	err := clubhouse.SearchStories(fmt.Sprintf("project:%q %s", project, query), stories)
+	if err != ErrSearchLimit {
+		return err
+	}
+
+	projectID, err := clubhouse.GetProjectByName(project)
+	if err != nil {
+		return err
+	}
+	err = clubhouse.GetProjectStories(projectID, &all)
+	if err != nil {
+		return err
+	}
+	for i := range all {
+		if keep(&all[i]) {
+			*stories = append(*stories, all[i])
+		}
+	}
+	return nil
+}
+
+// Reconcile compares the stories of CLUBHOUSE_PROJECT linked to Zendesk tickets
+// with the current ticket status, as webhooks may have been missed, and
+// optionally moves drifted stories to the state of their ticket, or reopens
+// done stories of open tickets
+func Reconcile(ctx context.Context, zendesk AbstractZendesk, options ReconcileOptions) (report ReconcileReport, err error) {
+	var stories = []ClubHouseStory{}
+	report.Drifts = []Drift{}
+
+	ctx, span := tracer.Start(ctx, "reconcile", trace.WithAttributes(attribute.Bool("reconcile.fix", options.Fix)))
+	defer func() { endSpan(span, err) }()
+	ctx = withActor(ctx, "reconcile")
+
+	clubhouse, err := newClubHouse(ctx)
+	if err != nil {
+		return report, err
+	}
+	err = projectStories(clubhouse, getEnv("CLUBHOUSE_PROJECT", "Support"), "!is:archived", func(story *ClubHouseStory) bool {
+		return !story.Archived
+	}, &stories)
+	if err != nil {
+		return report, err
+	}
+
+	var throttle <-chan time.Time
+	if options.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / options.Rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	for i := range stories {
+		ticketID, ok := strings.CutPrefix(stories[i].ExternalID, "zendesk-")
+		if !ok || ticketID == "" {
+			continue
+		}
+		if throttle != nil {
+			select {
+			case <-ctx.Done():
+				return report, ctx.Err()
+			case <-throttle:
+			}
+		} else if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		report.Checked++
+		drift, err := reconcileStory(ctx, clubhouse, zendesk, ticketID, &stories[i], options.Fix)
+		if err != nil {
+			loggerFrom(withStory(withTicket(ctx, ticketID), stories[i].ID)).Error("Fail to reconcile story", "error", err)
+			drift = &Drift{TicketID: ticketID, StoryID: stories[i].ID, Problem: DriftCheckFailed, Error: err.Error()}
+		}
+		if drift == nil {
+			continue
+		}
+		report.Drifts = append(report.Drifts, *drift)
+		if drift.Fixed {
+			report.Fixed++
+		}
+	}
+
+	return report, nil
+}
+
+// reconcileStory returns the drift of a story from its ticket, nil if they agree
+func reconcileStory(ctx context.Context, clubhouse AbstractClubHouse, zendesk AbstractZendesk, ticketID string, story *ClubHouseStory, fix bool) (*Drift, error) {
+	var apiTicket = ZendeskAPITicket{}
+	var drift = Drift{TicketID: ticketID, StoryID: story.ID}
+	var storyDone bool
+
+	ctx = withStory(withTicket(ctx, ticketID), story.ID)
+
+	if story.WorkflowStateID != 0 {
+		state, err := clubhouse.GetWorkflowStateByID(story.WorkflowStateID)
+		if err != nil {
+			return nil, err
+		}
+		drift.StoryState = state.Name
+		storyDone = state.Type == "done"
+	}
+
+	err := zendesk.GetTicket(ticketID, &apiTicket)
+	if err == os.ErrNotExist {
+		drift.Problem = DriftTicketMissing
+		return &drift, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	drift.TicketStatus = apiTicket.Status
+
+	expectedState := statusStateName(apiTicket.Status)
+	if expectedState == "" {
+		if !storyDone {
+			return nil, nil
+		}
+		drift.Problem = DriftStoryDone
+		drift.ExpectedState = getEnv("CLUBHOUSE_REOPENED_STATE", "Reopened")
+		if fix {
+			zendeskTicket := apiTicket.ToZendeskTicket(zendesk, nil, nil)
+			drift.Fixed, err = reopenStory(ctx, clubhouse, &zendeskTicket, story)
+			if err != nil {
+				loggerFrom(ctx).Error("Fail to reopen story", "error", err)
+				drift.Error = err.Error()
+			}
+		}
+		return &drift, nil
+	}
+
+	expectedStateID, err := clubhouse.GetWorkflowStateByName(getEnv("CLUBHOUSE_WORKFLOW", "Dev"), expectedState)
+	if err != nil {
+		return nil, err
+	}
+	if expectedStateID == story.WorkflowStateID {
+		return nil, nil
+	}
+	drift.Problem = DriftStateMismatch
+	drift.ExpectedState = expectedState
+
+	if fix {
+		zendeskTicket := apiTicket.ToZendeskTicket(zendesk, nil, nil)
+		err = syncTicketStatus(ctx, clubhouse, &zendeskTicket, story)
+		if err != nil {
+			loggerFrom(ctx).Error("Fail to fix drifted story", "error", err)
+			drift.Error = err.Error()
+		} else {
+			drift.Fixed = true
+		}
+	}
+	return &drift, nil
+}
@@ -0,0 +1,124 @@
+package cloudfunction
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestReconcile(t *testing.T) {
+	tests := map[string]struct {
+		options    ReconcileOptions
+		wantDrifts []Drift
+	}{
+		"report": {ReconcileOptions{}, []Drift{
+			{TicketID: "8888", StoryID: 888, Problem: DriftStateMismatch, TicketStatus: "solved", StoryState: "Created", ExpectedState: "Completed"},
+			{TicketID: "6666", StoryID: 666, Problem: DriftTicketMissing, StoryState: "Created"},
+		}},
+		"fix": {ReconcileOptions{Fix: true}, []Drift{
+			{TicketID: "8888", StoryID: 888, Problem: DriftStateMismatch, TicketStatus: "solved", StoryState: "Created", ExpectedState: "Completed", Fixed: true},
+			{TicketID: "6666", StoryID: 666, Problem: DriftTicketMissing, StoryState: "Created"},
+		}},
+	}
+
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			report, err := Reconcile(context.Background(), &MockZendesk{"unittest"}, tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Checked != 3 {
+				t.Errorf("got %d checked stories, want 3", report.Checked)
+			}
+			if !reflect.DeepEqual(report.Drifts, tt.wantDrifts) {
+				t.Errorf("got: %+v, want: %+v", report.Drifts, tt.wantDrifts)
+			}
+		})
+	}
+}
+
+// failingZendesk is the mock Zendesk failing to get one ticket
+type failingZendesk struct {
+	MockZendesk
+	failing string
+}
+
+func (z *failingZendesk) GetTicket(ticketID string, ticket *ZendeskAPITicket) error {
+	if ticketID == z.failing {
+		return fmt.Errorf("500 Internal Server Error")
+	}
+	return z.MockZendesk.GetTicket(ticketID, ticket)
+}
+
+func TestReconcile_failedStory(t *testing.T) {
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	report, err := Reconcile(context.Background(), &failingZendesk{MockZendesk{"unittest"}, "8888"}, ReconcileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 3 {
+		t.Errorf("got %d checked stories, want 3", report.Checked)
+	}
+	wantDrifts := []Drift{
+		{TicketID: "8888", StoryID: 888, Problem: DriftCheckFailed, Error: "500 Internal Server Error"},
+		{TicketID: "6666", StoryID: 666, Problem: DriftTicketMissing, StoryState: "Created"},
+	}
+	if !reflect.DeepEqual(report.Drifts, wantDrifts) {
+		t.Errorf("got: %+v, want: %+v", report.Drifts, wantDrifts)
+	}
+}
+
+func Test_reconcileStory_storyDone(t *testing.T) {
+	tests := map[string]struct {
+		fix  bool
+		want *Drift
+	}{
+		"report": {false, &Drift{TicketID: "7777", StoryID: 777, Problem: DriftStoryDone, TicketStatus: "open", StoryState: "Completed", ExpectedState: "Reopened"}},
+		"fix":    {true, &Drift{TicketID: "7777", StoryID: 777, Problem: DriftStoryDone, TicketStatus: "open", StoryState: "Completed", ExpectedState: "Reopened", Fixed: true}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			story := ClubHouseStory{ID: 777, ExternalID: "zendesk-7777", WorkflowStateID: 500000011}
+			clubhouse := &recordingClubHouse{states: map[int]ClubHouseWorkflowState{500000011: {ID: 500000011, Name: "Completed", Type: "done"}}}
+			drift, err := reconcileStory(context.Background(), clubhouse, &MockZendesk{"unittest"}, "7777", &story, tt.fix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(drift, tt.want) {
+				t.Errorf("got: %+v, want: %+v", drift, tt.want)
+			}
+		})
+	}
+}
+
+func Test_projectStories_fallback(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/search/stories",
+		httpmock.NewStringResponder(200, `{"data": [{"id": 777}], "next": "/api/v3/search/stories?next=a1", "total": 1001}`))
+	httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/projects",
+		httpmock.NewStringResponder(200, `[{"id": 55, "name": "Support"}]`))
+	httpmock.RegisterResponder("GET", ClubHouseAPIURL+"/api/v3/projects/55/stories",
+		httpmock.NewStringResponder(200, `[{"id": 777}, {"id": 888, "archived": true}, {"id": 999}]`))
+
+	stories := []ClubHouseStory{}
+	err := projectStories(&ClubHouse{"test"}, "Support", "!is:archived", func(story *ClubHouseStory) bool {
+		return !story.Archived
+	}, &stories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, story := range stories {
+		got = append(got, story.ID)
+	}
+	if !reflect.DeepEqual(got, []int{777, 999}) {
+		t.Errorf("got: %v, want: [777 999]", got)
+	}
+}
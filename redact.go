@@ -0,0 +1,152 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// detector finds one kind of sensitive data, valid rules out false positives of the pattern
+type detector struct {
+	name    string
+	pattern *regexp.Regexp
+	valid   func(string) bool
+}
+
+// builtinDetectors run in this order, API keys and card numbers first as
+// they contain digit runs the phone detector would take
+var builtinDetectors = []detector{
+	{"api_key", regexp.MustCompile(`\b(?:sk|pk|rk)_(?:live|test)_[A-Za-z0-9]{16,}\b|\bAKIA[0-9A-Z]{16}\b|\bgh[pousr]_[A-Za-z0-9]{36,}\b|\bxox[abprs]-[A-Za-z0-9-]{10,}\b|\bAIza[0-9A-Za-z_-]{35}\b|(?i:\b(?:api[_-]?key|secret|token|password)\s*[:=]\s*\S+)`), nil},
+	{"credit_card", regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), luhnValid},
+	{"email", regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), nil},
+	{"phone", regexp.MustCompile(`\+?\(?\d[\d\s().-]{6,}\d`), phoneValid},
+}
+
+func builtinDetector(name string) (detector, bool) {
+	for _, d := range builtinDetectors {
+		if d.name == name {
+			return d, true
+		}
+	}
+	return detector{}, false
+}
+
+// luhnValid tells card numbers from other long digit runs by their checksum
+func luhnValid(match string) bool {
+	sum, double := 0, false
+	for i := len(match) - 1; i >= 0; i-- {
+		if match[i] < '0' || match[i] > '9' {
+			continue
+		}
+		digit := int(match[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// phoneValid rules out dates, amounts and IDs, which are shorter than phone numbers
+func phoneValid(match string) bool {
+	digits := 0
+	for _, r := range match {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= 9 && digits <= 15
+}
+
+// RedactionCounts is the number of redactions by detector
+type RedactionCounts map[string]int
+
+// Redactor masks sensitive data before it reaches Clubhouse
+type Redactor struct {
+	detectors []detector
+}
+
+// newRedactor builds the redactor configured by REDACT_DETECTORS, the comma
+// separated built-in detectors (default all, none to disable), and
+// REDACT_PATTERNS, a JSON object of custom detector names to regular expressions
+func newRedactor() (*Redactor, error) {
+	var redactor = &Redactor{}
+
+	names := getEnv("REDACT_DETECTORS", "api_key,credit_card,email,phone")
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "none" {
+			continue
+		}
+		d, ok := builtinDetector(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction detector %q", name)
+		}
+		redactor.detectors = append(redactor.detectors, d)
+	}
+
+	if patterns := getEnv("REDACT_PATTERNS", ""); patterns != "" {
+		var custom map[string]string
+		err := json.Unmarshal([]byte(patterns), &custom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDACT_PATTERNS: %w", err)
+		}
+		customNames := make([]string, 0, len(custom))
+		for name := range custom {
+			customNames = append(customNames, name)
+		}
+		sort.Strings(customNames)
+		for _, name := range customNames {
+			pattern, err := regexp.Compile(custom[name])
+			if err != nil {
+				return nil, fmt.Errorf("invalid redaction pattern %s: %w", name, err)
+			}
+			redactor.detectors = append(redactor.detectors, detector{name, pattern, nil})
+		}
+	}
+	return redactor, nil
+}
+
+// with adds the built-in detectors the redactor does not run yet
+func (r *Redactor) with(names ...string) *Redactor {
+	var extended = &Redactor{append([]detector{}, r.detectors...)}
+	for _, name := range names {
+		if _, ok := extended.detector(name); ok {
+			continue
+		}
+		if d, ok := builtinDetector(name); ok {
+			extended.detectors = append(extended.detectors, d)
+		}
+	}
+	return extended
+}
+
+func (r *Redactor) detector(name string) (detector, bool) {
+	for _, d := range r.detectors {
+		if d.name == name {
+			return d, true
+		}
+	}
+	return detector{}, false
+}
+
+// Redact masks every detected value as [<detector> redacted] and adds them up in counts
+func (r *Redactor) Redact(text string, counts RedactionCounts) string {
+	for _, d := range r.detectors {
+		replacement := fmt.Sprintf("[%s redacted]", strings.ReplaceAll(d.name, "_", " "))
+		text = d.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			counts[d.name]++
+			return replacement
+		})
+	}
+	return text
+}
@@ -0,0 +1,92 @@
+package cloudfunction
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// ticketReopened tells whether the open ticket of a done story was reopened:
+// its previous status in the payload is solved or closed. Without it, the
+// done story of an open ticket is enough, stories completed by hand in
+// Clubhouse are then reopened as well
+func ticketReopened(zendeskTicket *ZendeskTicket) bool {
+	switch zendeskTicket.PreviousStatus {
+	case "", "solved", "closed":
+		return true
+	}
+	return false
+}
+
+// reopenComment keys the comment of a reopen by the completion it undoes, so
+// a retried webhook does not comment twice but every reopen is commented
+func reopenComment(story *ClubHouseStory) string {
+	if story.CompletedAt == nil {
+		return fmt.Sprintf("reopen-%d", story.ID)
+	}
+	return fmt.Sprintf("reopen-%d-%d", story.ID, story.CompletedAt.Unix())
+}
+
+// reopenStory moves the done story of a ticket back to CLUBHOUSE_REOPENED_STATE
+// when Zendesk reopens the ticket, i.e. its status goes from solved or closed
+// back to new, open or on-hold, and comments on the story why. It tells
+// whether the story was reopened
+func reopenStory(ctx context.Context, clubhouse AbstractClubHouse, zendeskTicket *ZendeskTicket, story *ClubHouseStory) (bool, error) {
+	var current = ClubHouseStory{}
+
+	if zendeskTicket.Status == "" || statusStateName(zendeskTicket.Status) != "" || story.WorkflowStateID == 0 {
+		return false, nil
+	}
+
+	state, err := clubhouse.GetWorkflowStateByID(story.WorkflowStateID)
+	if err != nil {
+		return false, err
+	}
+	if state.Type != "done" {
+		return false, nil
+	}
+	if !ticketReopened(zendeskTicket) {
+		loggerFrom(ctx).Info("Ticket was not reopened, the story stays done", "state", state.Name, "previous_status", zendeskTicket.PreviousStatus)
+		return false, nil
+	}
+
+	reopenedState := getEnv("CLUBHOUSE_REOPENED_STATE", "Reopened")
+	reopenedStateID, err := clubhouse.GetWorkflowStateByName(getEnv("CLUBHOUSE_WORKFLOW", "Dev"), reopenedState)
+	if err == os.ErrNotExist {
+		loggerFrom(ctx).Warn("Reopened state not found, the story stays done", "state", reopenedState)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// The comment goes first, a story never ends up reopened without it
+	err = clubhouse.GetStory(story.ID, &current)
+	if err != nil {
+		return false, err
+	}
+	externalID := reopenComment(&current)
+	commented := false
+	for _, comment := range current.Comments {
+		if comment.ExternalID == externalID {
+			commented = true
+			break
+		}
+	}
+	if !commented {
+		text := fmt.Sprintf("The Zendesk ticket was reopened (status %s), so this story was moved back from %s to %s.", zendeskTicket.Status, state.Name, reopenedState)
+		err = clubhouse.CreateComment(story.ID, &ClubHouseComment{Text: text, ExternalID: externalID})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = clubhouse.UpdateStoryState(story.ID, reopenedStateID)
+	if err != nil {
+		return false, err
+	}
+	story.WorkflowStateID = reopenedStateID
+	audit(ctx, AuditEntry{Action: AuditStoryReopened, TicketID: zendeskTicket.ID, StoryID: story.ID, Before: state.Name, After: reopenedState})
+	loggerFrom(ctx).Info("Story reopened", "from", state.Name, "to", reopenedState)
+	return true, nil
+}
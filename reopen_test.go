@@ -0,0 +1,90 @@
+package cloudfunction
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reopenClubHouse has story 500000010 done and a Reopened state 500000012
+func reopenClubHouse() *recordingClubHouse {
+	return &recordingClubHouse{
+		states:   map[int]ClubHouseWorkflowState{500000010: {ID: 500000010, Name: "Completed", Type: "done"}},
+		stateIDs: map[string]int{"Reopened": 500000012, "NON_EXIST_STATE": 0},
+	}
+}
+
+func Test_reopenStory(t *testing.T) {
+	tests := map[string]struct {
+		status         string
+		previousStatus string
+		stateID        int
+		reopenedState  string
+		comments       []ClubHouseComment
+		want           bool
+		wantComment    bool
+	}{
+		"reopened":           {"open", "solved", 500000010, "", nil, true, true},
+		"on hold":            {"hold", "closed", 500000010, "", nil, true, true},
+		"no previous status": {"open", "", 500000010, "", nil, true, true},
+		"previously pending": {"open", "pending", 500000010, "", nil, false, false},
+		"previously open":    {"open", "open", 500000010, "", nil, false, false},
+		"already commented":  {"open", "solved", 500000010, "", []ClubHouseComment{{ID: 1, ExternalID: "reopen-888"}}, true, false},
+		"not done":           {"open", "solved", 500000011, "", nil, false, false},
+		"solved":             {"solved", "open", 500000010, "", nil, false, false},
+		"pending":            {"pending", "solved", 500000010, "", nil, false, false},
+		"no status":          {"", "solved", 500000010, "", nil, false, false},
+		"no reopened state":  {"open", "solved", 500000010, "NON_EXIST_STATE", nil, false, false},
+	}
+
+	defer os.Unsetenv("CLUBHOUSE_REOPENED_STATE")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			os.Unsetenv("CLUBHOUSE_REOPENED_STATE")
+			if tt.reopenedState != "" {
+				os.Setenv("CLUBHOUSE_REOPENED_STATE", tt.reopenedState)
+			}
+			clubhouse := reopenClubHouse()
+			clubhouse.story.Comments = tt.comments
+			story := ClubHouseStory{ID: 888, WorkflowStateID: tt.stateID}
+			ticket := ZendeskTicket{ID: "8888", Status: tt.status, PreviousStatus: tt.previousStatus}
+			got, err := reopenStory(context.Background(), clubhouse, &ticket, &story)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got: %v, want: %v", got, tt.want)
+			}
+			if !tt.want {
+				if len(clubhouse.moves) != 0 || len(clubhouse.comments) != 0 {
+					t.Errorf("story should be left alone, got states %v and comments %v", clubhouse.moves, clubhouse.comments)
+				}
+				return
+			}
+			if story.WorkflowStateID != 500000012 || len(clubhouse.moves) != 1 || clubhouse.moves[0] != 500000012 {
+				t.Errorf("story should be moved to the reopened state, got %v", clubhouse.moves)
+			}
+			if !tt.wantComment {
+				if len(clubhouse.comments) != 0 {
+					t.Errorf("got comments: %v, want none", clubhouse.comments)
+				}
+				return
+			}
+			if len(clubhouse.comments) != 1 || !strings.Contains(clubhouse.comments[0].Text, "from Completed to Reopened") || clubhouse.comments[0].ExternalID != "reopen-888" {
+				t.Errorf("got comments: %v", clubhouse.comments)
+			}
+		})
+	}
+}
+
+func Test_reopenComment(t *testing.T) {
+	completed := time.Unix(1700000000, 0)
+	if got := reopenComment(&ClubHouseStory{ID: 888}); got != "reopen-888" {
+		t.Errorf("got: %s, want: reopen-888", got)
+	}
+	if got := reopenComment(&ClubHouseStory{ID: 888, CompletedAt: &completed}); got != "reopen-888-1700000000" {
+		t.Errorf("got: %s, want: reopen-888-1700000000", got)
+	}
+}
@@ -0,0 +1,219 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+)
+
+var router = newRouter()
+
+// newRouter maps the REST routes to ticket actions, the legacy method-based
+// behaviour stays on every path outside /tickets for existing Zendesk triggers
+func newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /tickets", ticketHandler(ActionCreate, http.StatusCreated))
+	mux.HandleFunc("GET /tickets/{id}", getTicketHandler)
+	mux.HandleFunc("DELETE /tickets/{id}", ticketHandler(ActionClose, http.StatusOK))
+	mux.HandleFunc("POST /tickets/{id}/comments", ticketHandler(ActionComment, http.StatusCreated))
+	mux.HandleFunc("PUT /tickets/{id}/status", ticketHandler(ActionStatus, http.StatusOK))
+	mux.HandleFunc("GET /tickets/{id}/audit", requireCredentials(auditHandler))
+	mux.HandleFunc("GET /admin/dead-letters", requireCredentials(listDeadLettersHandler))
+	mux.HandleFunc("GET /admin/dead-letters/{id}", requireCredentials(getDeadLetterHandler))
+	mux.HandleFunc("DELETE /admin/dead-letters/{id}", requireCredentials(deleteDeadLetterHandler))
+	mux.HandleFunc("POST /admin/dead-letters/{id}/replay", requireCredentials(replayDeadLetterHandler))
+	mux.HandleFunc("POST /admin/sla-check", requireCredentials(slaCheckHandler))
+	mux.HandleFunc("/tickets", methodNotAllowedHandler)
+	mux.HandleFunc("/tickets/", methodNotAllowedHandler)
+	mux.HandleFunc("/", legacyHandler)
+	return mux
+}
+
+// methodNotAllowedHandler answers the ticket paths without a route for the
+// method, the legacy behaviour would ignore the ticket ID in their path
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
+
+// requireCredentials refuses the route unless AUTH_USER or AUTH_PASSWORD is
+// set, the basic auth of ZendeskClubhouseAdapter lets everyone through
+// otherwise. Admin routes expose ticket payloads and must not be open
+func requireCredentials(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if os.Getenv("AUTH_USER") == "" && os.Getenv("AUTH_PASSWORD") == "" {
+			loggerFrom(r.Context()).Warn("Admin route refused without AUTH_USER and AUTH_PASSWORD", "path", r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// ticketHandler decodes the Zendesk payload, the ticket ID in the path takes precedence over the body.
+// With a queue set the event is only validated and enqueued, and acknowledged with 202 Accepted
+func ticketHandler(action string, successStatus int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var zendeskTicket = ZendeskTicket{}
+
+		err := decodeTicket(r, &zendeskTicket)
+		if err != nil {
+			webhooksTotal.WithLabelValues(action, webhookOutcome(err)).Inc()
+			writeError(w, r, err)
+			return
+		}
+		if id := r.PathValue("id"); id != "" {
+			zendeskTicket.ID = id
+		}
+
+		event := NewEvent(action, zendeskTicket)
+		event.Actor = requestActor(r)
+		event.CorrelationID = w.Header().Get("X-Request-ID")
+		if isDryRun(r) {
+			dryRunHandler(w, r, event)
+			return
+		}
+
+		if eventQueue != nil {
+			injectTraceContext(r.Context(), event)
+			err = validateEvent(event)
+			if err == nil {
+				err = eventQueue.Enqueue(event)
+			}
+			if err != nil {
+				webhooksTotal.WithLabelValues(action, webhookOutcome(err)).Inc()
+				writeError(w, r, err)
+				return
+			}
+			webhooksTotal.WithLabelValues(action, "queued").Inc()
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		event.Attempts++
+		err = ProcessEvent(r.Context(), event)
+		webhooksTotal.WithLabelValues(action, webhookOutcome(err)).Inc()
+		if err != nil {
+			if needsDeadLetter(err) {
+				deadLetter(r.Context(), event, err)
+			}
+			writeError(w, r, err)
+			return
+		}
+		w.WriteHeader(successStatus)
+	}
+}
+
+// dryRunHandler processes the event without writing to Clubhouse and answers
+// with the plan of what it would have written
+func dryRunHandler(w http.ResponseWriter, r *http.Request, event *Event) {
+	var plan = &DryRunPlan{Action: event.Action, TicketID: event.Ticket.ID, Audit: []AuditEntry{}}
+
+	err := ProcessEvent(withDryRun(r.Context(), plan), event)
+	webhooksTotal.WithLabelValues(event.Action, "dry_run_"+webhookOutcome(err)).Inc()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, plan)
+}
+
+// requestActor names the basic auth user, or Zendesk for unauthenticated webhooks
+func requestActor(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	return "zendesk"
+}
+
+func getTicketHandler(w http.ResponseWriter, r *http.Request) {
+	var zendeskTicket = ZendeskTicket{ID: r.PathValue("id")}
+	var linkedStory = LinkedStory{}
+
+	err := getLinkedStory(r.Context(), &zendeskTicket, &linkedStory)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, linkedStory)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := AuditLog().Query(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, entries)
+}
+
+func listDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	deadLetters, err := DeadLetters().List()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, deadLetters)
+}
+
+func getDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	var deadLetter = DeadLetter{}
+
+	err := DeadLetters().Get(r.PathValue("id"), &deadLetter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, deadLetter)
+}
+
+func deleteDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	err := DeadLetters().Delete(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func replayDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	err := ReplayDeadLetter(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if eventQueue != nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func slaCheckHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := CheckDeadlines(r.Context(), SLACheckOptions{})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// legacyHandler maps POST/PUT/DELETE on the root path to create/update/close
+func legacyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		ticketHandler(ActionCreate, http.StatusCreated)(w, r)
+	case http.MethodPut:
+		ticketHandler(ActionUpdate, http.StatusCreated)(w, r)
+	case http.MethodDelete:
+		ticketHandler(ActionClose, http.StatusCreated)(w, r)
+	default:
+		// Unsupported method
+		w.WriteHeader(http.StatusTeapot)
+	}
+}
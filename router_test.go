@@ -0,0 +1,60 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		path       string
+		payload    string
+		wantStatus int
+	}{
+		"create ticket":                      {http.MethodPost, "/tickets", `{"title": "unit test", "id": "7777", "url": "http://unittest.io" }`, http.StatusCreated},
+		"create unlinked ticket":             {http.MethodPost, "/tickets", `{"title": "unit test", "id": "9999", "url": "http://unittest.io" }`, http.StatusCreated},
+		"create ticket with invalid payload": {http.MethodPost, "/tickets", `{}`, http.StatusBadRequest},
+		"create ticket with broken payload":  {http.MethodPost, "/tickets", `{"title":`, http.StatusBadRequest},
+		"get linked story":                   {http.MethodGet, "/tickets/7777", "", http.StatusOK},
+		"get non-exist linked story":         {http.MethodGet, "/tickets/NON_EXIST_ID", "", http.StatusNotFound},
+		"comment on ticket":                  {http.MethodPost, "/tickets/7777/comments", `{"description": "Hello world"}`, http.StatusCreated},
+		"comment on non-exist ticket":        {http.MethodPost, "/tickets/NON_EXIST_ID/comments", `{"description": "Hello world"}`, http.StatusNotFound},
+		"update ticket status":               {http.MethodPut, "/tickets/7777/status", `{"status": "Pending"}`, http.StatusOK},
+		"update ticket status to solved":     {http.MethodPut, "/tickets/7777/status", `{"status": "Solved"}`, http.StatusOK},
+		"close ticket":                       {http.MethodDelete, "/tickets/7777", "", http.StatusOK},
+		"unsupported method on route":        {http.MethodPatch, "/tickets/7777", "", http.StatusMethodNotAllowed},
+		"update on ticket path":              {http.MethodPut, "/tickets/7777", `{"title": "unit test", "id": "8888"}`, http.StatusMethodNotAllowed},
+		"create on ticket path":              {http.MethodPost, "/tickets/7777", `{"title": "unit test", "id": "8888"}`, http.StatusMethodNotAllowed},
+		"unknown ticket route":               {http.MethodPost, "/tickets/7777/unknown", "", http.StatusMethodNotAllowed},
+		"unsupported method on collection":   {http.MethodPut, "/tickets", "", http.StatusMethodNotAllowed},
+		"legacy create ticket":               {http.MethodPost, "/", `{"title": "unit test", "id": "7777", "url": "http://unittest.io" }`, http.StatusCreated},
+		"legacy create ticket on other path": {http.MethodPost, "/ZendeskClubhouseAdapter", `{"title": "unit test", "id": "7777", "url": "http://unittest.io" }`, http.StatusCreated},
+		"legacy close ticket on other path":  {http.MethodDelete, "/hooks/zendesk?source=trigger", `{"id": "7777"}`, http.StatusCreated},
+		"legacy unsupported method":          {http.MethodGet, "/", "", http.StatusTeapot},
+		"legacy unsupported method on path":  {http.MethodGet, "/unknown", "", http.StatusTeapot},
+		"SLA check without credentials":      {http.MethodPost, "/admin/sla-check", "", http.StatusForbidden},
+	}
+
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	os.Setenv("AUTH_USER", "")
+	os.Setenv("AUTH_PASSWORD", "")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.path, bytes.NewBuffer([]byte(tt.payload)))
+
+			ZendeskClubhouseAdapter(w, r)
+
+			rw := w.Result()
+			defer rw.Body.Close()
+
+			if s := rw.StatusCode; s != tt.wantStatus {
+				t.Fatalf("got: %d, want: %d", s, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package cloudfunction
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SLAApproaching = "approaching" // the deadline is within the warning window
+	SLABreached    = "breached"    // the deadline has passed
+)
+
+// slaPriorityOffsets parses SLA_PRIORITY_DEADLINES, comma separated
+// priority=duration pairs such as urgent=4h,high=24h
+func slaPriorityOffsets() (map[string]time.Duration, error) {
+	var offsets = map[string]time.Duration{}
+
+	for _, entry := range strings.Split(os.Getenv("SLA_PRIORITY_DEADLINES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		priority, offset, found := strings.Cut(entry, "=")
+		duration, err := time.ParseDuration(strings.TrimSpace(offset))
+		if !found || err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid SLA priority deadline %q", entry)
+		}
+		offsets[strings.ToLower(strings.TrimSpace(priority))] = duration
+	}
+	return offsets, nil
+}
+
+// storyDeadline is the earliest SLA breach of the ticket or, without SLA
+// targets, the offset of its priority from its creation per
+// SLA_PRIORITY_DEADLINES. Nil if neither applies
+func storyDeadline(offsets map[string]time.Duration, zendeskTicket *ZendeskTicket, now time.Time) *time.Time {
+	var deadline *time.Time
+
+	for _, target := range zendeskTicket.SLA {
+		if target.BreachAt != nil && (deadline == nil || target.BreachAt.Before(*deadline)) {
+			deadline = target.BreachAt
+		}
+	}
+	if deadline != nil {
+		return deadline
+	}
+
+	offset, ok := offsets[zendeskTicket.Priority]
+	if !ok {
+		return nil
+	}
+	if zendeskTicket.CreatedAt != nil {
+		now = *zendeskTicket.CreatedAt
+	}
+	priorityDeadline := now.Add(offset).UTC()
+	return &priorityDeadline
+}
+
+type SLACheckOptions struct {
+	Window time.Duration // how long before their deadline stories are flagged, SLA_WARNING_WINDOW by default
+}
+
+// SLAFlag is a story flagged as approaching or past its deadline
+type SLAFlag struct {
+	TicketID string    `json:"ticket_id"`
+	StoryID  int       `json:"story_id"`
+	Deadline time.Time `json:"deadline"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type SLAReport struct {
+	Checked int       `json:"checked"`
+	Flagged []SLAFlag `json:"flagged"`
+}
+
+// CheckDeadlines flags the open stories of CLUBHOUSE_PROJECT whose deadline is
+// approaching or past with a label and a comment. The label marks the story as
+// flagged, so running the check on a schedule flags every story once per status
+func CheckDeadlines(ctx context.Context, options SLACheckOptions) (report SLAReport, err error) {
+	var stories = []ClubHouseStory{}
+	report.Flagged = []SLAFlag{}
+
+	ctx, span := tracer.Start(ctx, "sla_check", trace.WithAttributes(attribute.String("sla.window", options.Window.String())))
+	defer func() { endSpan(span, err) }()
+	ctx = withActor(ctx, "sla-check")
+
+	if options.Window == 0 {
+		options.Window, err = time.ParseDuration(getEnv("SLA_WARNING_WINDOW", "4h"))
+		if err != nil {
+			return report, fmt.Errorf("invalid SLA_WARNING_WINDOW: %w", err)
+		}
+	}
+
+	clubhouse, err := newClubHouse(ctx)
+	if err != nil {
+		return report, err
+	}
+	err = projectStories(clubhouse, getEnv("CLUBHOUSE_PROJECT", "Support"), "has:deadline !is:done !is:archived", func(story *ClubHouseStory) bool {
+		return story.Deadline != nil && !story.Completed && !story.Archived
+	}, &stories)
+	if err != nil {
+		return report, err
+	}
+
+	now := time.Now()
+	for i := range stories {
+		if stories[i].Deadline == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		report.Checked++
+		if flag := checkDeadline(ctx, clubhouse, &stories[i], options.Window, now); flag != nil {
+			report.Flagged = append(report.Flagged, *flag)
+		}
+	}
+	return report, nil
+}
+
+func slaLabel(status string) string {
+	if status == SLABreached {
+		return getEnv("SLA_BREACHED_LABEL", "sla-breached")
+	}
+	return getEnv("SLA_APPROACHING_LABEL", "sla-approaching")
+}
+
+// checkDeadline labels and comments a story approaching or past its deadline,
+// nil if it is not or if it already has the label of its status
+func checkDeadline(ctx context.Context, clubhouse AbstractClubHouse, story *ClubHouseStory, window time.Duration, now time.Time) *SLAFlag {
+	var status, text string
+
+	deadline := *story.Deadline
+	switch {
+	case !now.Before(deadline):
+		status = SLABreached
+		text = fmt.Sprintf("The Zendesk SLA deadline of this story passed at %s.", deadline.UTC().Format(time.RFC1123))
+	case deadline.Sub(now) <= window:
+		status = SLAApproaching
+		text = fmt.Sprintf("The Zendesk SLA deadline of this story is %s, in %s.", deadline.UTC().Format(time.RFC1123), deadline.Sub(now).Round(time.Minute))
+	default:
+		return nil
+	}
+
+	label := slaLabel(status)
+	for _, existing := range story.Labels {
+		if strings.EqualFold(existing.Name, label) {
+			return nil
+		}
+	}
+
+	ticketID := strings.TrimPrefix(story.ExternalID, "zendesk-")
+	ctx = withStory(withTicket(ctx, ticketID), story.ID)
+	flag := &SLAFlag{TicketID: ticketID, StoryID: story.ID, Deadline: deadline, Status: status}
+
+	// The comment goes first, the label would keep a story whose comment
+	// failed from being commented on the next check
+	err := commentDeadline(clubhouse, story.ID, &ClubHouseComment{Text: text, ExternalID: fmt.Sprintf("sla-%d-%s", story.ID, status)})
+	if err == nil {
+		labels := append(append([]ClubHouseLabel{}, story.Labels...), ClubHouseLabel{Name: label})
+		err = clubhouse.UpdateStoryLabels(story.ID, labels)
+	}
+	if err != nil {
+		loggerFrom(ctx).Error("Fail to flag story deadline", "status", status, "error", err)
+		flag.Error = err.Error()
+		return flag
+	}
+
+	loggerFrom(ctx).Info("Story deadline flagged", "status", status, "deadline", deadline)
+	audit(ctx, AuditEntry{Action: AuditDeadlineFlagged, TicketID: ticketID, StoryID: story.ID, After: status})
+	return flag
+}
+
+// commentDeadline comments on the story unless a previous check, whose label
+// failed, already did
+func commentDeadline(clubhouse AbstractClubHouse, storyID int, comment *ClubHouseComment) error {
+	var current = ClubHouseStory{}
+
+	err := clubhouse.GetStory(storyID, &current)
+	if err != nil {
+		return err
+	}
+	for _, existing := range current.Comments {
+		if existing.ExternalID == comment.ExternalID {
+			return nil
+		}
+	}
+	return clubhouse.CreateComment(storyID, comment)
+}
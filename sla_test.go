@@ -0,0 +1,87 @@
+package cloudfunction
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_storyDeadline(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	created := now.Add(-2 * time.Hour)
+	early, late := now.Add(time.Hour), now.Add(3*time.Hour)
+	tests := map[string]struct {
+		offsets string
+		ticket  ZendeskTicket
+		want    *time.Time
+		wantErr bool
+	}{
+		"earliest SLA target": {"urgent=4h", ZendeskTicket{Priority: "urgent", SLA: ZendeskSLATargets{{"next_reply_time", &late}, {"agent_work_time", &early}}}, &early, false},
+		"priority offset":     {"urgent=4h,high=24h", ZendeskTicket{Priority: "urgent"}, ptr(now.Add(4 * time.Hour)), false},
+		"from creation":       {"urgent=4h", ZendeskTicket{Priority: "urgent", CreatedAt: &created}, ptr(now.Add(2 * time.Hour)), false},
+		"no offset":           {"urgent=4h", ZendeskTicket{Priority: "low"}, nil, false},
+		"invalid offset":      {"urgent=soon", ZendeskTicket{Priority: "urgent"}, nil, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := setConfig(t, "SLA_PRIORITY_DEADLINES", tt.offsets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := storyDeadline(loadedConfig.Load().SLAOffsets, &tt.ticket, now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func Test_checkDeadline(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		story        ClubHouseStory
+		comments     []ClubHouseComment // comments of the story in Clubhouse
+		want         *SLAFlag
+		wantLabels   []ClubHouseLabel
+		wantComments int
+	}{
+		"far away": {ClubHouseStory{ID: 777, Deadline: ptr(now.Add(24 * time.Hour))}, nil, nil, nil, 0},
+		"approaching": {ClubHouseStory{ID: 777, ExternalID: "zendesk-7777", Deadline: ptr(now.Add(2 * time.Hour)), Labels: []ClubHouseLabel{{ID: 1, Name: "vip"}}}, nil,
+			&SLAFlag{TicketID: "7777", StoryID: 777, Deadline: now.Add(2 * time.Hour), Status: SLAApproaching},
+			[]ClubHouseLabel{{ID: 1, Name: "vip"}, {Name: "sla-approaching"}}, 1},
+		"breached": {ClubHouseStory{ID: 777, ExternalID: "zendesk-7777", Deadline: ptr(now.Add(-time.Hour)), Labels: []ClubHouseLabel{{ID: 2, Name: "sla-approaching"}}}, nil,
+			&SLAFlag{TicketID: "7777", StoryID: 777, Deadline: now.Add(-time.Hour), Status: SLABreached},
+			[]ClubHouseLabel{{ID: 2, Name: "sla-approaching"}, {Name: "sla-breached"}}, 1},
+		"already commented": {ClubHouseStory{ID: 777, ExternalID: "zendesk-7777", Deadline: ptr(now.Add(-time.Hour))}, []ClubHouseComment{{ID: 1, ExternalID: "sla-777-breached"}},
+			&SLAFlag{TicketID: "7777", StoryID: 777, Deadline: now.Add(-time.Hour), Status: SLABreached},
+			[]ClubHouseLabel{{Name: "sla-breached"}}, 0},
+		"already flagged": {ClubHouseStory{ID: 777, Deadline: ptr(now.Add(-time.Hour)), Labels: []ClubHouseLabel{{ID: 3, Name: "SLA-Breached"}}}, nil, nil, nil, 0},
+		"failed": {ClubHouseStory{ID: 500, ExternalID: "zendesk-5000", Deadline: ptr(now)}, nil,
+			&SLAFlag{TicketID: "5000", StoryID: 500, Deadline: now, Status: SLABreached, Error: "500 Internal Server Error"}, nil, 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			clubhouse := &recordingClubHouse{story: ClubHouseStory{Comments: tt.comments}, failing: 500}
+			got := checkDeadline(context.Background(), clubhouse, &tt.story, 4*time.Hour, now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got: %+v, want: %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(clubhouse.labels, tt.wantLabels) {
+				t.Errorf("got labels: %v, want: %v", clubhouse.labels, tt.wantLabels)
+			}
+			if len(clubhouse.comments) != tt.wantComments {
+				t.Errorf("got comments: %v, want: %d", clubhouse.comments, tt.wantComments)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// taskTemplates parses TASK_TEMPLATES, a JSON object of the tickets a template
+// applies to, story_type:<story type>, * for every story or an epic rule
+// match such as tag:escalated or priority:urgent, to the task descriptions
+func taskTemplates() (map[string][]string, error) {
+	var templates map[string][]string
+
+	config := getEnv("TASK_TEMPLATES", "")
+	if config == "" {
+		return nil, nil
+	}
+	err := json.Unmarshal([]byte(config), &templates)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TASK_TEMPLATES: %w", err)
+	}
+	for match := range templates {
+		kind, value, _ := strings.Cut(match, ":")
+		if match != "*" && ((kind != "story_type" && !slices.Contains(epicRuleKinds, kind)) || value == "") {
+			return nil, fmt.Errorf("invalid task template %q", match)
+		}
+	}
+	return templates, nil
+}
+
+// checklistItem is a Markdown task list item, or a line starting with a ballot box
+var checklistItem = regexp.MustCompile(`^\s*(?:[-*+]\s+|\d+[.)]\s+)?(?:\[([ xX])\]|(☐|☑|☒|✅))\s+(.+?)\s*$`)
+
+// checklistTasks are the tasks of the checklist items of a description, checked items are complete
+func checklistTasks(description string) []ClubHouseTask {
+	var tasks []ClubHouseTask
+	for _, line := range strings.Split(description, "\n") {
+		match := checklistItem.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		complete := strings.EqualFold(match[1], "x") || (match[2] != "" && match[2] != "☐")
+		tasks = append(tasks, ClubHouseTask{Description: match[3], Complete: complete})
+	}
+	return tasks
+}
+
+// storyTasks are the tasks of every matching template of TASK_TEMPLATES, sorted by match, followed by the checklist of the
+// description unless TASKS_FROM_CHECKLIST is false. Tasks with the same description are created once
+func storyTasks(templates map[string][]string, zendeskTicket *ZendeskTicket, story *ClubHouseStory) []ClubHouseTask {
+	var tasks []ClubHouseTask
+	var seen = map[string]bool{}
+
+	add := func(task ClubHouseTask) {
+		key := strings.ToLower(task.Description)
+		if task.Description == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		tasks = append(tasks, task)
+	}
+
+	matches := make([]string, 0, len(templates))
+	for match := range templates {
+		matches = append(matches, match)
+	}
+	sort.Strings(matches)
+	for _, match := range matches {
+		kind, value, _ := strings.Cut(match, ":")
+		switch {
+		case match == "*":
+		case kind == "story_type":
+			if !strings.EqualFold(value, story.StoryType) {
+				continue
+			}
+		case !ticketMatches(zendeskTicket, kind, value):
+			continue
+		}
+		for _, description := range templates[match] {
+			add(ClubHouseTask{Description: strings.TrimSpace(description)})
+		}
+	}
+
+	if fromChecklist, _ := strconv.ParseBool(getEnv("TASKS_FROM_CHECKLIST", "true")); fromChecklist {
+		for _, task := range checklistTasks(story.Description) {
+			add(task)
+		}
+	}
+	return tasks
+}
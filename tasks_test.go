@@ -0,0 +1,65 @@
+package cloudfunction
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_checklistTasks(t *testing.T) {
+	description := "Steps so far:\n- [ ] Reproduce on staging\n* [x] Collect logs\n1. [ ] Check the version\n☐ Ask for a HAR file\n✅ Clear the cache\n[link](http://example.com) [ ] not a task\n- [ ]\n"
+	want := []ClubHouseTask{
+		{Description: "Reproduce on staging"},
+		{Description: "Collect logs", Complete: true},
+		{Description: "Check the version"},
+		{Description: "Ask for a HAR file"},
+		{Description: "Clear the cache", Complete: true},
+	}
+	if got := checklistTasks(description); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func Test_storyTasks(t *testing.T) {
+	templates := `{"*": ["Link the Zendesk ticket"], "story_type:bug": ["Reproduce", "Add a regression test"], "tag:escalated": ["Reproduce", "Page the on-call"]}`
+	tests := map[string]struct {
+		templates string
+		checklist string
+		ticket    ZendeskTicket
+		story     ClubHouseStory
+		want      []ClubHouseTask
+		wantErr   bool
+	}{
+		"no templates": {"", "", ZendeskTicket{}, ClubHouseStory{StoryType: "bug"}, nil, false},
+		"story type": {templates, "", ZendeskTicket{}, ClubHouseStory{StoryType: "bug"},
+			[]ClubHouseTask{{Description: "Link the Zendesk ticket"}, {Description: "Reproduce"}, {Description: "Add a regression test"}}, false},
+		"route deduplicated": {templates, "", ZendeskTicket{Tags: ZendeskTags{"Escalated"}}, ClubHouseStory{StoryType: "bug"},
+			[]ClubHouseTask{{Description: "Link the Zendesk ticket"}, {Description: "Reproduce"}, {Description: "Add a regression test"}, {Description: "Page the on-call"}}, false},
+		"checklist": {templates, "", ZendeskTicket{}, ClubHouseStory{StoryType: "chore", Description: "- [ ] Try another browser\n- [x] link the zendesk ticket"},
+			[]ClubHouseTask{{Description: "Link the Zendesk ticket"}, {Description: "Try another browser"}}, false},
+		"checklist disabled": {"", "false", ZendeskTicket{}, ClubHouseStory{Description: "- [ ] Try another browser"}, nil, false},
+		"invalid match":      {`{"team:Support": ["Triage"]}`, "", ZendeskTicket{}, ClubHouseStory{}, nil, true},
+		"invalid templates":  {`{"*": "Triage"}`, "", ZendeskTicket{}, ClubHouseStory{}, nil, true},
+	}
+
+	defer os.Unsetenv("TASKS_FROM_CHECKLIST")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			os.Setenv("TASKS_FROM_CHECKLIST", tt.checklist)
+			if tt.checklist == "" {
+				os.Unsetenv("TASKS_FROM_CHECKLIST")
+			}
+			err := setConfig(t, "TASK_TEMPLATES", tt.templates)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := storyTasks(loadedConfig.Load().TaskTemplates, &tt.ticket, &tt.story)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package cloudfunction
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	tracer            = otel.Tracer("cloudfunction")
+	tracingOnce       sync.Once
+	tracerProvider    *sdktrace.TracerProvider
+	tracingPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+)
+
+// InitTracing sets up the exporter chosen by OTEL_TRACES_EXPORTER: otlp (configured
+// by the standard OTEL_EXPORTER_OTLP_* variables), stdout or none. Long running
+// processes batch spans, functions export them before the response is sent,
+// as the instance may be frozen right after
+func InitTracing(ctx context.Context, batch bool) {
+	tracingOnce.Do(func() {
+		otel.SetTextMapPropagator(tracingPropagator)
+
+		var exporter sdktrace.SpanExporter
+		var err error
+		switch strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")) {
+		case "otlp":
+			exporter, err = otlptracehttp.New(ctx)
+		case "stdout":
+			exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+		default:
+			return
+		}
+		if err != nil {
+			slog.Error("Fail to set up trace exporter, tracing disabled", "error", err)
+			return
+		}
+
+		res := resource.Default()
+		if os.Getenv("OTEL_SERVICE_NAME") == "" {
+			res, _ = resource.Merge(res, resource.NewSchemaless(attribute.String("service.name", "zendesk-clubhouse-adapter")))
+		}
+
+		processor := sdktrace.NewSimpleSpanProcessor(exporter)
+		if batch {
+			processor = sdktrace.NewBatchSpanProcessor(exporter)
+		}
+		tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor), sdktrace.WithResource(res))
+		otel.SetTracerProvider(tracerProvider)
+	})
+}
+
+// ShutdownTracing exports the remaining spans
+func ShutdownTracing(ctx context.Context) error {
+	if tracerProvider == nil {
+		return nil
+	}
+	return tracerProvider.Shutdown(ctx)
+}
+
+// endSpan records the outcome of a span, missing stories are not errors
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != os.ErrNotExist {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// statusRecorder remembers the response status for the server span
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// startRequestSpan continues the trace of the caller's traceparent header
+func startRequestSpan(r *http.Request) (context.Context, trace.Span) {
+	ctx := tracingPropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return tracer.Start(ctx, r.Method+" ZendeskClubhouseAdapter",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+		))
+}
+
+func endRequestSpan(span trace.Span, status int) {
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// injectTraceContext keeps the trace of a request for its queued event
+func injectTraceContext(ctx context.Context, event *Event) {
+	carrier := propagation.MapCarrier{}
+	tracingPropagator.Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		event.TraceContext = carrier
+	}
+}
+
+// extractTraceContext continues the trace of a queued event, unless ctx is already traced
+func extractTraceContext(ctx context.Context, event *Event) context.Context {
+	if trace.SpanContextFromContext(ctx).IsValid() || len(event.TraceContext) == 0 {
+		return ctx
+	}
+	return tracingPropagator.Extract(ctx, propagation.MapCarrier(event.TraceContext))
+}
+
+// tracedClubHouse wraps every Clubhouse call in a span
+type tracedClubHouse struct {
+	ctx       context.Context
+	clubhouse AbstractClubHouse
+}
+
+func (c *tracedClubHouse) start(name string, attributes ...attribute.KeyValue) trace.Span {
+	_, span := tracer.Start(c.ctx, "clubhouse."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...))
+	return span
+}
+
+func (c *tracedClubHouse) CurrentIteration(iteration *ClubHouseIteration) (err error) {
+	span := c.start("CurrentIteration")
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.CurrentIteration(iteration)
+}
+
+func (c *tracedClubHouse) ListIterations(iterations *[]ClubHouseIteration) (err error) {
+	span := c.start("ListIterations")
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.ListIterations(iterations)
+}
+
+func (c *tracedClubHouse) GetStoryByExternalID(externalID string, story *ClubHouseStory) (err error) {
+	span := c.start("GetStoryByExternalID", attribute.String("clubhouse.external_id", externalID))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetStoryByExternalID(externalID, story)
+}
+
+func (c *tracedClubHouse) GetStory(storyID int, story *ClubHouseStory) (err error) {
+	span := c.start("GetStory", attribute.Int("clubhouse.story_id", storyID))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetStory(storyID, story)
+}
+
+func (c *tracedClubHouse) GetWorkflowStateByName(workflowName string, stateName string) (stateID int, err error) {
+	span := c.start("GetWorkflowStateByName", attribute.String("clubhouse.workflow", workflowName), attribute.String("clubhouse.state", stateName))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetWorkflowStateByName(workflowName, stateName)
+}
+
+func (c *tracedClubHouse) GetProjectByName(name string) (projectID int, err error) {
+	span := c.start("GetProjectByName", attribute.String("clubhouse.project", name))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetProjectByName(name)
+}
+
+func (c *tracedClubHouse) GetTeamByName(name string) (teamID string, err error) {
+	span := c.start("GetTeamByName", attribute.String("clubhouse.team", name))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetTeamByName(name)
+}
+
+func (c *tracedClubHouse) CreateStory(story *ClubHouseStory) (err error) {
+	span := c.start("CreateStory")
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.CreateStory(story)
+}
+
+func (c *tracedClubHouse) AddCommentOnStory(storyID int, text string) (err error) {
+	span := c.start("AddCommentOnStory", attribute.Int("clubhouse.story_id", storyID))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.AddCommentOnStory(storyID, text)
+}
+
+func (c *tracedClubHouse) CreateComment(storyID int, comment *ClubHouseComment) (err error) {
+	span := c.start("CreateComment", attribute.Int("clubhouse.story_id", storyID))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.CreateComment(storyID, comment)
+}
+
+func (c *tracedClubHouse) UpdateStoryState(storyID int, stateID int) (err error) {
+	span := c.start("UpdateStoryState", attribute.Int("clubhouse.story_id", storyID), attribute.Int("clubhouse.state_id", stateID))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.UpdateStoryState(storyID, stateID)
+}
+
+func (c *tracedClubHouse) GetWorkflowStateByID(stateID int) (state ClubHouseWorkflowState, err error) {
+	span := c.start("GetWorkflowStateByID", attribute.Int("clubhouse.state_id", stateID))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetWorkflowStateByID(stateID)
+}
+
+func (c *tracedClubHouse) GetIteration(iterationID int, iteration *ClubHouseIteration) (err error) {
+	span := c.start("GetIteration", attribute.Int("clubhouse.iteration_id", iterationID))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetIteration(iterationID, iteration)
+}
+
+func (c *tracedClubHouse) GetMember(memberID string, member *ClubHouseMember) (err error) {
+	span := c.start("GetMember", attribute.String("clubhouse.member_id", memberID))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetMember(memberID, member)
+}
+
+func (c *tracedClubHouse) GetMemberByEmail(email string, member *ClubHouseMember) (err error) {
+	span := c.start("GetMemberByEmail")
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetMemberByEmail(email, member)
+}
+
+func (c *tracedClubHouse) UpdateStoryOwners(storyID int, ownerIDs []string) (err error) {
+	span := c.start("UpdateStoryOwners", attribute.Int("clubhouse.story_id", storyID))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.UpdateStoryOwners(storyID, ownerIDs)
+}
+
+func (c *tracedClubHouse) UpdateStoryLabels(storyID int, labels []ClubHouseLabel) (err error) {
+	span := c.start("UpdateStoryLabels", attribute.Int("clubhouse.story_id", storyID))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.UpdateStoryLabels(storyID, labels)
+}
+
+func (c *tracedClubHouse) GetEpicByName(name string) (epicID int, err error) {
+	span := c.start("GetEpicByName", attribute.String("clubhouse.epic", name))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetEpicByName(name)
+}
+
+func (c *tracedClubHouse) CreateEpic(epic *ClubHouseEpic) (err error) {
+	span := c.start("CreateEpic", attribute.String("clubhouse.epic", epic.Name))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.CreateEpic(epic)
+}
+
+func (c *tracedClubHouse) GetMilestoneByName(name string) (milestoneID int, err error) {
+	span := c.start("GetMilestoneByName", attribute.String("clubhouse.milestone", name))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetMilestoneByName(name)
+}
+
+func (c *tracedClubHouse) SearchStories(query string, stories *[]ClubHouseStory) (err error) {
+	span := c.start("SearchStories", attribute.String("clubhouse.query", query))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.SearchStories(query, stories)
+}
+
+func (c *tracedClubHouse) GetProjectStories(projectID int, stories *[]ClubHouseStory) (err error) {
+	span := c.start("GetProjectStories", attribute.Int("clubhouse.project_id", projectID))
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.GetProjectStories(projectID, stories)
+}
+
+func (c *tracedClubHouse) ListCustomFields(fields *[]ClubHouseCustomField) (err error) {
+	span := c.start("ListCustomFields")
+	defer func() { endSpan(span, err) }()
+	return c.clubhouse.ListCustomFields(fields)
+}
+
+// tracedZendesk wraps every Zendesk call in a span
+type tracedZendesk struct {
+	ctx     context.Context
+	zendesk AbstractZendesk
+}
+
+func (z *tracedZendesk) start(name string, attributes ...attribute.KeyValue) trace.Span {
+	_, span := tracer.Start(z.ctx, "zendesk."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...))
+	return span
+}
+
+func (z *tracedZendesk) SearchTickets(query string, pageURL string, page *ZendeskTicketPage) (err error) {
+	span := z.start("SearchTickets", attribute.String("zendesk.query", query))
+	defer func() { endSpan(span, err) }()
+	return z.zendesk.SearchTickets(query, pageURL, page)
+}
+
+func (z *tracedZendesk) ViewTickets(viewID string, pageURL string, page *ZendeskTicketPage) (err error) {
+	span := z.start("ViewTickets", attribute.String("zendesk.view_id", viewID))
+	defer func() { endSpan(span, err) }()
+	return z.zendesk.ViewTickets(viewID, pageURL, page)
+}
+
+func (z *tracedZendesk) GetTicket(ticketID string, ticket *ZendeskAPITicket) (err error) {
+	span := z.start("GetTicket", attribute.String("zendesk.ticket_id", ticketID))
+	defer func() { endSpan(span, err) }()
+	return z.zendesk.GetTicket(ticketID, ticket)
+}
+
+func (z *tracedZendesk) TicketURL(ticketID int64) string {
+	return z.zendesk.TicketURL(ticketID)
+}
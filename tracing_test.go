@@ -0,0 +1,57 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestZendeskClubhouseAdapter_Tracing(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	os.Setenv("CH_TOKEN", "MOCK_CLUBHOUSE")
+	SetMappingStore(NewMemoryMappingStore())
+	os.Setenv("AUTH_USER", "")
+	os.Setenv("AUTH_PASSWORD", "")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/tickets/7777/status", bytes.NewBuffer([]byte(`{"status": "Solved"}`)))
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	ZendeskClubhouseAdapter(w, r)
+
+	spans := map[string]bool{}
+	for _, span := range exporter.GetSpans() {
+		if span.SpanContext.TraceID().String() != traceID {
+			t.Errorf("span %s should continue trace %s, got %s", span.Name, traceID, span.SpanContext.TraceID())
+		}
+		spans[span.Name] = true
+	}
+	for _, name := range []string{"PUT ZendeskClubhouseAdapter", "process status", "clubhouse.GetStoryByExternalID", "clubhouse.UpdateStoryState"} {
+		if !spans[name] {
+			t.Errorf("missing span %s, got %v", name, spans)
+		}
+	}
+
+	// Queued events keep the trace of the webhook
+	exporter.Reset()
+	event := NewEvent(ActionStatus, ZendeskTicket{ID: "7777", Status: "Solved"})
+	ctx, span := tracer.Start(context.Background(), "webhook")
+	injectTraceContext(ctx, event)
+	span.End()
+	if err := ProcessEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range exporter.GetSpans() {
+		if s.SpanContext.TraceID() != span.SpanContext().TraceID() {
+			t.Errorf("span %s should continue the trace of the webhook", s.Name)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package cloudfunction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ZendeskAPITicket is a ticket as returned by the Zendesk API, unlike
+// ZendeskTicket which is the payload of the webhooks
+type ZendeskAPITicket struct {
+	ID             int64               `json:"id"`
+	Subject        string              `json:"subject"`
+	Description    string              `json:"description"`
+	Status         string              `json:"status"`
+	OrganizationID int64               `json:"organization_id"`
+	RequesterID    int64               `json:"requester_id"`
+	AssigneeID     int64               `json:"assignee_id"`
+	Priority       string              `json:"priority"`
+	Type           string              `json:"type"`
+	Tags           ZendeskTags         `json:"tags"`
+	CustomFields   ZendeskCustomFields `json:"custom_fields"`
+	CreatedAt      *time.Time          `json:"created_at"`
+	UpdatedAt      *time.Time          `json:"updated_at"`
+}
+
+type ZendeskOrganization struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// ZendeskAPIUser is a requester or assignee sideloaded with the tickets
+type ZendeskAPIUser struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// ZendeskTicketPage is one page of tickets with their organizations and
+// users, NextPage is empty on the last page
+type ZendeskTicketPage struct {
+	Tickets       []ZendeskAPITicket
+	Organizations []ZendeskOrganization
+	Users         []ZendeskAPIUser
+	NextPage      string
+}
+
+type AbstractZendesk interface {
+	SearchTickets(string, string, *ZendeskTicketPage) error
+	ViewTickets(string, string, *ZendeskTicketPage) error
+	GetTicket(string, *ZendeskAPITicket) error
+	TicketURL(int64) string
+}
+
+type Zendesk struct {
+	Subdomain string
+	Email     string
+	Token     string
+	ctx       context.Context // cancels requests and rate limit waits, nil for none
+}
+
+// zendeskMaxWait caps the time waited out for rate limits by one request
+var zendeskMaxWait = 2 * time.Minute
+
+type MockZendesk struct {
+	Subdomain string
+}
+
+func ZendeskBuilder(subdomain string, email string, token string) AbstractZendesk {
+	if subdomain == "MOCK_ZENDESK" {
+		return &MockZendesk{subdomain}
+	}
+	return &Zendesk{Subdomain: subdomain, Email: email, Token: token}
+}
+
+// NewZendesk returns the client configured by ZENDESK_SUBDOMAIN, ZENDESK_EMAIL
+// and ZENDESK_API_TOKEN, its calls are traced as part of ctx
+func NewZendesk(ctx context.Context) (AbstractZendesk, error) {
+	subdomain := os.Getenv("ZENDESK_SUBDOMAIN")
+	if subdomain == "" {
+		return nil, os.ErrInvalid
+	}
+	zendesk := ZendeskBuilder(subdomain, os.Getenv("ZENDESK_EMAIL"), os.Getenv("ZENDESK_API_TOKEN"))
+	if client, ok := zendesk.(*Zendesk); ok {
+		client.ctx = ctx
+	}
+	return &tracedZendesk{ctx, zendesk}, nil
+}
+
+func (z *Zendesk) baseURL() string {
+	return getEnv("ZENDESK_API_URL", fmt.Sprintf("https://%s.zendesk.com", z.Subdomain))
+}
+
+// get decodes a Zendesk API response, waiting out rate limits as told by
+// Retry-After for up to zendeskMaxWait in total
+func (z *Zendesk) get(URL string, v interface{}) error {
+	var waited time.Duration
+
+	ctx := z.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, URL, nil)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(z.Email+"/token", z.Token)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 5 {
+			retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+			if err != nil || retryAfter <= 0 {
+				retryAfter = 10
+			}
+			wait := time.Duration(retryAfter) * time.Second
+			if waited+wait <= zendeskMaxWait {
+				resp.Body.Close()
+				waited += wait
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+				continue
+			}
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == 404 {
+			return os.ErrNotExist
+		}
+		if resp.StatusCode != 200 {
+			return fmt.Errorf(resp.Status)
+		}
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+}
+
+// SearchTickets pages through the search export, unlike the plain search it
+// is cursor based and not limited to 1000 results. Results are not sorted
+func (z *Zendesk) SearchTickets(query string, pageURL string, page *ZendeskTicketPage) error {
+	var result struct {
+		Results       []ZendeskAPITicket    `json:"results"`
+		Organizations []ZendeskOrganization `json:"organizations"`
+		Users         []ZendeskAPIUser      `json:"users"`
+		Meta          struct {
+			HasMore bool `json:"has_more"`
+		} `json:"meta"`
+		Links struct {
+			Next string `json:"next"`
+		} `json:"links"`
+	}
+
+	if page == nil {
+		return fmt.Errorf("no page provided")
+	}
+	if pageURL == "" {
+		pageURL = fmt.Sprintf("%s/api/v2/search/export.json?include=tickets(users,organizations)&filter[type]=ticket&page[size]=100&query=%s",
+			z.baseURL(), url.QueryEscape(query))
+	}
+
+	err := z.get(pageURL, &result)
+	if err != nil {
+		return err
+	}
+	*page = ZendeskTicketPage{result.Results, result.Organizations, result.Users, ""}
+	if result.Meta.HasMore {
+		page.NextPage = result.Links.Next
+	}
+	return nil
+}
+
+func (z *Zendesk) ViewTickets(viewID string, pageURL string, page *ZendeskTicketPage) error {
+	var result struct {
+		Tickets       []ZendeskAPITicket    `json:"tickets"`
+		Organizations []ZendeskOrganization `json:"organizations"`
+		Users         []ZendeskAPIUser      `json:"users"`
+		NextPage      string                `json:"next_page"`
+	}
+
+	if page == nil {
+		return fmt.Errorf("no page provided")
+	}
+	if pageURL == "" {
+		pageURL = fmt.Sprintf("%s/api/v2/views/%s/tickets.json?include=users,organizations", z.baseURL(), url.PathEscape(viewID))
+	}
+
+	err := z.get(pageURL, &result)
+	if err != nil {
+		return err
+	}
+	*page = ZendeskTicketPage{result.Tickets, result.Organizations, result.Users, result.NextPage}
+	return nil
+}
+
+func (z *Zendesk) GetTicket(ticketID string, ticket *ZendeskAPITicket) error {
+	var result struct {
+		Ticket ZendeskAPITicket `json:"ticket"`
+	}
+
+	if ticket == nil {
+		return fmt.Errorf("no ticket provided")
+	}
+
+	err := z.get(fmt.Sprintf("%s/api/v2/tickets/%s.json", z.baseURL(), url.PathEscape(ticketID)), &result)
+	if err != nil {
+		return err
+	}
+	*ticket = result.Ticket
+	return nil
+}
+
+// TicketURL is the agent URL of a ticket, as sent by the webhooks
+func (z *Zendesk) TicketURL(ticketID int64) string {
+	return fmt.Sprintf("https://%s.zendesk.com/agent/tickets/%d", z.Subdomain, ticketID)
+}
+
+// mockZendeskTickets come in two pages, 9999 is the only one without a story
+var mockZendeskTickets = []ZendeskAPITicket{
+	{ID: 7777, Subject: "unit test", Description: "Hello world", Status: "open", OrganizationID: 1},
+	{ID: 9999, Subject: "unit test", Description: "Hello world", Status: "new", OrganizationID: 1},
+	{ID: 8888, Subject: "unit test", Description: "Hello world", Status: "solved"},
+}
+
+func (z *MockZendesk) SearchTickets(query string, pageURL string, page *ZendeskTicketPage) error {
+	switch pageURL {
+	case "":
+		*page = ZendeskTicketPage{mockZendeskTickets[:2], []ZendeskOrganization{{1, "InfuseAI"}}, nil, "page-2"}
+	case "page-2":
+		*page = ZendeskTicketPage{mockZendeskTickets[2:], nil, nil, ""}
+	default:
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+func (z *MockZendesk) ViewTickets(viewID string, pageURL string, page *ZendeskTicketPage) error {
+	return z.SearchTickets("", pageURL, page)
+}
+
+func (z *MockZendesk) GetTicket(ticketID string, ticket *ZendeskAPITicket) error {
+	for _, t := range mockZendeskTickets {
+		if strconv.FormatInt(t.ID, 10) == ticketID {
+			*ticket = t
+			return nil
+		}
+	}
+	return os.ErrNotExist
+}
+
+func (z *MockZendesk) TicketURL(ticketID int64) string {
+	return fmt.Sprintf("https://%s.zendesk.com/agent/tickets/%d", z.Subdomain, ticketID)
+}
+
+// ToZendeskTicket converts an API ticket to the webhook payload the adapter
+// syncs, with the organization and users sideloaded with it
+func (t *ZendeskAPITicket) ToZendeskTicket(zendesk AbstractZendesk, organizations []ZendeskOrganization, users []ZendeskAPIUser) ZendeskTicket {
+	var organization string
+	for _, org := range organizations {
+		if org.ID == t.OrganizationID {
+			organization = org.Name
+		}
+	}
+	var requester, assignee *ZendeskUser
+	for _, user := range users {
+		if user.ID == t.RequesterID {
+			requester = &ZendeskUser{Name: user.Name, Email: user.Email}
+		}
+		if user.ID == t.AssigneeID {
+			assignee = &ZendeskUser{Name: user.Name, Email: user.Email}
+		}
+	}
+	return ZendeskTicket{
+		Title:        t.Subject,
+		Description:  t.Description,
+		Organization: organization,
+		ID:           strconv.FormatInt(t.ID, 10),
+		URL:          zendesk.TicketURL(t.ID),
+		Status:       t.Status,
+		Requester:    requester,
+		Assignee:     assignee,
+		Priority:     t.Priority,
+		Type:         t.Type,
+		Tags:         t.Tags,
+		CustomFields: t.CustomFields,
+		CreatedAt:    t.CreatedAt,
+		UpdatedAt:    t.UpdatedAt,
+	}
+}
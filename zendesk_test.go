@@ -0,0 +1,130 @@
+package cloudfunction
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestZendesk_SearchTickets(t *testing.T) {
+	tests := map[string]struct {
+		pageURL    string
+		statusCode int
+		body       string
+		wantPage   ZendeskTicketPage
+		wantErr    bool
+	}{
+		"first page": {"", 200, `{"results": [{"id": 1, "subject": "Hello", "organization_id": 2, "requester_id": 3}], "organizations": [{"id": 2, "name": "InfuseAI"}], "users": [{"id": 3, "name": "John", "email": "john@infuseai.io"}], "meta": {"has_more": true}, "links": {"next": "https://unittest.zendesk.com/api/v2/search/export.json?page[after]=abc"}}`,
+			ZendeskTicketPage{[]ZendeskAPITicket{{ID: 1, Subject: "Hello", OrganizationID: 2, RequesterID: 3}}, []ZendeskOrganization{{2, "InfuseAI"}}, []ZendeskAPIUser{{3, "John", "john@infuseai.io"}}, "https://unittest.zendesk.com/api/v2/search/export.json?page[after]=abc"}, false},
+		"last page": {"https://unittest.zendesk.com/api/v2/search/export.json?page[after]=abc", 200, `{"results": [{"id": 3}], "meta": {"has_more": false}, "links": {"next": "https://unittest.zendesk.com/api/v2/search/export.json?page[after]=def"}}`,
+			ZendeskTicketPage{Tickets: []ZendeskAPITicket{{ID: 3}}}, false},
+		"unauthorized": {"", 401, `{"error": "Couldn't authenticate you"}`, ZendeskTicketPage{}, true},
+	}
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var page = ZendeskTicketPage{}
+			httpmock.Reset()
+			httpmock.RegisterResponder("GET", "https://unittest.zendesk.com/api/v2/search/export.json",
+				func(req *http.Request) (*http.Response, error) {
+					if user, password, _ := req.BasicAuth(); user != "agent@unittest.io/token" || password != "secret" {
+						return httpmock.NewStringResponse(401, ""), nil
+					}
+					if tt.pageURL == "" && (req.URL.Query().Get("query") != "status<solved" || req.URL.Query().Get("filter[type]") != "ticket") {
+						return httpmock.NewStringResponse(400, ""), nil
+					}
+					return httpmock.NewStringResponse(tt.statusCode, tt.body), nil
+				})
+
+			z := &Zendesk{Subdomain: "unittest", Email: "agent@unittest.io", Token: "secret"}
+			err := z.SearchTickets("status<solved", tt.pageURL, &page)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SearchTickets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(page, tt.wantPage) {
+				t.Errorf("got: %+v, want: %+v", page, tt.wantPage)
+			}
+		})
+	}
+}
+
+func TestZendesk_GetTicket(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://unittest.zendesk.com/api/v2/tickets/7777.json",
+		httpmock.NewStringResponder(200, `{"ticket": {"id": 7777, "subject": "unit test", "status": "open"}}`))
+	httpmock.RegisterResponder("GET", "https://unittest.zendesk.com/api/v2/tickets/8888.json",
+		httpmock.NewStringResponder(404, `{"error": "RecordNotFound"}`))
+
+	var ticket = ZendeskAPITicket{}
+	z := &Zendesk{Subdomain: "unittest", Email: "agent@unittest.io", Token: "secret"}
+	if err := z.GetTicket("7777", &ticket); err != nil || ticket.Status != "open" {
+		t.Fatalf("got: %+v %v, want an open ticket", ticket, err)
+	}
+	if err := z.GetTicket("8888", &ticket); err != os.ErrNotExist {
+		t.Fatalf("got: %v, want: %v", err, os.ErrNotExist)
+	}
+}
+
+func TestZendesk_GetTicket_rateLimit(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://unittest.zendesk.com/api/v2/tickets/7777.json", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(429, "")
+		resp.Header.Set("Retry-After", "60")
+		return resp, nil
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		var ticket = ZendeskAPITicket{}
+		z := &Zendesk{Subdomain: "unittest", Email: "agent@unittest.io", Token: "secret", ctx: ctx}
+		start := time.Now()
+		if err := z.GetTicket("7777", &ticket); err != context.DeadlineExceeded {
+			t.Fatalf("got: %v, want: %v", err, context.DeadlineExceeded)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("waited %s after the context was done", elapsed)
+		}
+	})
+
+	t.Run("capped", func(t *testing.T) {
+		defer func(wait time.Duration) { zendeskMaxWait = wait }(zendeskMaxWait)
+		zendeskMaxWait = 30 * time.Second
+		var ticket = ZendeskAPITicket{}
+		z := &Zendesk{Subdomain: "unittest", Email: "agent@unittest.io", Token: "secret"}
+		if err := z.GetTicket("7777", &ticket); err == nil || err.Error() != "429" {
+			t.Fatalf("got: %v, want: 429", err)
+		}
+	})
+}
+
+func TestZendeskAPITicket_ToZendeskTicket(t *testing.T) {
+	z := &MockZendesk{"unittest"}
+	ticket := mockZendeskTickets[0]
+	ticket.RequesterID, ticket.AssigneeID = 3, 4
+	got := ticket.ToZendeskTicket(z, []ZendeskOrganization{{1, "InfuseAI"}},
+		[]ZendeskAPIUser{{3, "Customer", "customer@unittest.io"}, {4, "John", "john@infuseai.io"}})
+	want := ZendeskTicket{
+		Title:        "unit test",
+		Description:  "Hello world",
+		Organization: "InfuseAI",
+		ID:           "7777",
+		URL:          "https://unittest.zendesk.com/agent/tickets/7777",
+		Status:       "open",
+		Requester:    &ZendeskUser{Name: "Customer", Email: "customer@unittest.io"},
+		Assignee:     &ZendeskUser{Name: "John", Email: "john@infuseai.io"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+}